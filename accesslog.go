@@ -0,0 +1,110 @@
+package gee_cache
+
+import (
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 最近访问的环形缓冲区，用于事后分析
+
+// AccessRecord 是一次 Get 的记录。为了避免在内存中保留 key 的内容，只记录 key 的 FNV-1a 哈希值。
+type AccessRecord struct {
+	Seq      uint64        // 全局递增的序号，反映访问的先后顺序
+	KeyHash  uint64        // key 的 64 位 FNV-1a 哈希值
+	Hit      bool          // 是否命中缓存
+	Time     time.Time     // Get 开始的时间
+	Duration time.Duration // Get 的耗时，未命中时包括加载的时间
+}
+
+// accessLogShards 是环形缓冲区的分片数，按记录的序号轮流选择分片，减少并发 Get 之间的锁竞争。
+// 不按 key 分片：热点 key 的所有 Get 会集中到同一个分片，而这正是最需要记录的时候
+const accessLogShards = 16
+
+// accessLog 是分片的访问记录环形缓冲区，每个分片保留最近的若干条记录
+type accessLog struct {
+	seq    atomic.Uint64
+	shards [accessLogShards]accessLogShard
+}
+
+type accessLogShard struct {
+	mu      sync.Mutex
+	records []AccessRecord
+	next    int // 下一个写入的位置
+}
+
+// newAccessLog 创建一个总共保留约 size 条记录的环形缓冲区
+func newAccessLog(size int) *accessLog {
+	l := &accessLog{}
+	perShard := max((size+accessLogShards-1)/accessLogShards, 1)
+	for i := range l.shards {
+		l.shards[i].records = make([]AccessRecord, 0, perShard)
+	}
+	return l
+}
+
+func (l *accessLog) add(key string, hit bool, start time.Time) {
+	r := AccessRecord{
+		Seq:      l.seq.Add(1),
+		KeyHash:  fnv64a(key),
+		Hit:      hit,
+		Time:     start,
+		Duration: time.Since(start),
+	}
+	s := &l.shards[r.Seq%accessLogShards]
+	s.mu.Lock()
+	if len(s.records) < cap(s.records) {
+		s.records = append(s.records, r)
+	} else {
+		s.records[s.next] = r
+		s.next = (s.next + 1) % len(s.records)
+	}
+	s.mu.Unlock()
+}
+
+// snapshot 返回所有分片中的记录，按 Seq 从旧到新排序
+func (l *accessLog) snapshot() []AccessRecord {
+	var records []AccessRecord
+	for i := range l.shards {
+		s := &l.shards[i]
+		s.mu.Lock()
+		records = append(records, s.records...)
+		s.mu.Unlock()
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Seq < records[j].Seq })
+	return records
+}
+
+// fnv64a 计算 key 的 64 位 FNV-1a 哈希值，不需要像 hash/fnv 那样分配内存
+func fnv64a(key string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= prime64
+	}
+	return h
+}
+
+// sampled 判断本次 Get 是否执行开销较大的统计，按 sampleRate 随机抽样
+func (g *Group) sampled() bool {
+	if g.sampleRate >= 1 {
+		return true
+	}
+	return rand.Float64() < g.sampleRate
+}
+
+// RecentAccesses 返回最近的 Get 记录，按访问的先后顺序排列，需要先通过 WithAccessLog 开启，否则返回 nil。
+// 每个分片独立淘汰旧记录，因此返回的是每个分片最近的记录，最旧的一部分记录可能来自不同的时间段。
+// 设置了 WithSampleRate 时只包含被抽样的 Get。
+func (g *Group) RecentAccesses() []AccessRecord {
+	if g.accessLog == nil {
+		return nil
+	}
+	return g.accessLog.snapshot()
+}
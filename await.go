@@ -0,0 +1,99 @@
+package gee_cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// 等待 key 被写入
+
+// Await 等待 key 出现在缓存中：已经在缓存中时立即返回，否则阻塞直到 Set、加载等写入了该 key，
+// 或者 ctx 被取消（返回 ctx.Err()）、group 被关闭（返回 ErrClosed）。Await 自己不会调用 getter。
+// 等待同一个 key 的多个调用共享同一次唤醒。被唤醒时该 key 如果已经又被淘汰，会继续等待下一次写入。
+func (g *Group) Await(ctx context.Context, key string) (ByteView, error) {
+	key = g.normalizeKey(key)
+	for {
+		if g.closed.Load() {
+			return ByteView{}, ErrClosed
+		}
+		if v, _, ok := g.mainCache.get(key); ok {
+			return v, nil
+		}
+		// 先登记再检查一次，避免错过两次检查之间的写入
+		ch := g.waiters.add(key)
+		if v, _, ok := g.mainCache.get(key); ok {
+			g.waiters.remove(key, ch)
+			return v, nil
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			g.waiters.remove(key, ch)
+			return ByteView{}, ctx.Err()
+		case <-g.done:
+			g.waiters.remove(key, ch)
+			return ByteView{}, ErrClosed
+		}
+	}
+}
+
+// waiters 管理 Await 的等待者，同一个 key 的等待者共享一个 channel，写入 key 时关闭它
+type waiters struct {
+	mu sync.Mutex
+	n  atomic.Int32 // 正在等待的 key 的数量，没有等待者时 wake 不需要加锁
+	m  map[string]*waiter
+}
+
+type waiter struct {
+	ch   chan struct{}
+	refs int // 仍在等待、尚未被唤醒的调用数
+}
+
+// add 登记一个等待 key 的调用，返回写入 key 时会被关闭的 channel
+func (w *waiters) add(key string) <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.m == nil {
+		w.m = make(map[string]*waiter)
+	}
+	wt, ok := w.m[key]
+	if !ok {
+		wt = &waiter{ch: make(chan struct{})}
+		w.m[key] = wt
+		w.n.Add(1)
+	}
+	wt.refs++
+	return wt.ch
+}
+
+// remove 取消一个等待 key 的调用，ch 是 add 返回的 channel，最后一个等待者离开时删除 key 的记录
+func (w *waiters) remove(key string, ch <-chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wt, ok := w.m[key]
+	if !ok || wt.ch != ch { // 已经被 wake 唤醒并删除，可能又有了新的等待者
+		return
+	}
+	if wt.refs--; wt.refs == 0 {
+		delete(w.m, key)
+		w.n.Add(-1)
+	}
+}
+
+// wake 唤醒所有等待 key 的调用，在 key 被写入缓存之后调用
+func (w *waiters) wake(key string) {
+	if w.n.Load() == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if wt, ok := w.m[key]; ok {
+		close(wt.ch)
+		delete(w.m, key)
+		w.n.Add(-1)
+	}
+}
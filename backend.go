@@ -0,0 +1,79 @@
+package gee_cache
+
+import (
+	"log"
+	"time"
+)
+
+// 外部缓存层
+
+// Backend 是位于本地缓存和 getter 之间的外部缓存（例如 Redis）。
+// 本地缓存未命中时先查询 Backend，Backend 也未命中时才调用 getter，从 getter 加载的值会同时写入两层缓存。
+// 通过 WithLoadStages 可以按顺序注册多层 Backend，例如先查询同机房的缓存，再查询区域共享的缓存。
+type Backend interface {
+	// Get 返回 key 对应的值以及是否存在
+	Get(key string) ([]byte, bool, error)
+	// Set 写入 key 对应的值
+	Set(key string, value []byte) error
+}
+
+// getFromBackend 从外部缓存获取值，命中时写入本地缓存
+// 外部缓存出错时只记录日志，继续查询下一层或者从 getter 加载
+func (g *Group) getFromBackend(b Backend, key string) (ByteView, bool) {
+	bytes, ok, err := b.Get(key)
+	if err != nil {
+		log.Printf("[GeeCache] backend get %s failed: %v", key, err)
+		return ByteView{}, false
+	}
+	if !ok {
+		return ByteView{}, false
+	}
+	if g.oversized(bytes) {
+		return ByteView{b: bytes}, true
+	}
+	value := g.mainCache.addLoaded(key, &item{value: ByteView{b: g.mainCache.buffers.clone(bytes)}})
+	return value, true
+}
+
+// getFromBackendBefore 与 getFromBackend 相同，deadline 不为零值时最多等待到 deadline，超时返回 ErrDeadlineExceeded
+func (g *Group) getFromBackendBefore(b Backend, key string, deadline time.Time) (ByteView, bool, error) {
+	if deadline.IsZero() {
+		value, ok := g.getFromBackend(b, key)
+		return value, ok, nil
+	}
+	type hit struct {
+		value ByteView
+		ok    bool
+	}
+	h, err := runWithin(g, time.Until(deadline), ErrDeadlineExceeded, func() (hit, error) {
+		value, ok := g.getFromBackend(b, key)
+		return hit{value, ok}, nil
+	})
+	return h.value, h.ok, err
+}
+
+// getFromBackends 按顺序查询各层外部缓存，第一个命中的值写入本地缓存以及它之前未命中的各层
+func (g *Group) getFromBackends(key string, deadline time.Time) (ByteView, bool, error) {
+	for i, b := range g.backends {
+		value, ok, err := g.getFromBackendBefore(b, key, deadline)
+		if err != nil {
+			return ByteView{}, false, err
+		}
+		if ok {
+			if !g.oversized(value.b) {
+				g.setToBackends(g.backends[:i], key, value)
+			}
+			return value, true, nil
+		}
+	}
+	return ByteView{}, false, nil
+}
+
+// setToBackends 将值写入 backends 中的每一层外部缓存，value 必须已经交给了调用方，它的缓冲区不会被复用
+func (g *Group) setToBackends(backends []Backend, key string, value ByteView) {
+	for _, backend := range backends {
+		if err := backend.Set(key, value.b); err != nil {
+			log.Printf("[GeeCache] backend set %s failed: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package gee_cache
+
+import (
+	"sync"
+	"time"
+)
+
+// 加载失败后的退避
+
+// loadFailure 记录某个 key 最近一次加载失败的错误以及允许重试的时间
+type loadFailure struct {
+	err      error
+	attempts int       // 连续失败的次数
+	retryAt  time.Time // 在此之前的 Get 直接返回 err
+}
+
+// defaultMaxBackoff 是没有设置上限（max 为 0）时退避时长的上限
+const defaultMaxBackoff = 10 * time.Minute
+
+// minSweepSize 是 failures 中的记录数达到多少之后才开始清理过期的记录
+const minSweepSize = 64
+
+// backoff 对连续加载失败的 key 做指数退避，base 为 0 时不启用
+type backoff struct {
+	mu       sync.Mutex
+	base     time.Duration // 第一次失败后的退避时长
+	max      time.Duration // 退避时长的上限，为 0 时使用 defaultMaxBackoff
+	failures map[string]*loadFailure
+	sweepAt  int // failures 中的记录数达到 sweepAt 时清理过期的记录
+}
+
+// check 如果 key 仍处于退避窗口内，返回最近一次加载失败的错误，否则返回 nil
+func (b *backoff) check(key string) error {
+	if b.base <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if f, ok := b.failures[key]; ok && time.Now().Before(f.retryAt) {
+		return f.err
+	}
+	return nil
+}
+
+// fail 记录一次加载失败，每次连续失败退避时长翻倍，最多为 max
+func (b *backoff) fail(key string, err error) {
+	if b.base <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures == nil {
+		b.failures = make(map[string]*loadFailure)
+	}
+	f, ok := b.failures[key]
+	if !ok {
+		f = &loadFailure{}
+		b.failures[key] = f
+	}
+	f.err = err
+	f.attempts++
+	now := time.Now()
+	f.retryAt = now.Add(b.delay(f.attempts))
+	if len(b.failures) >= b.sweepAt {
+		b.sweep(now)
+	}
+}
+
+// limit 返回退避时长的上限
+func (b *backoff) limit() time.Duration {
+	if b.max > 0 {
+		return b.max
+	}
+	return defaultMaxBackoff
+}
+
+// delay 返回连续失败 attempts 次之后的退避时长 base * 2^(attempts-1)，不超过 limit，也不会溢出
+func (b *backoff) delay(attempts int) time.Duration {
+	limit := b.limit()
+	if shift := attempts - 1; shift < 63 && b.base <= limit>>shift {
+		return b.base << shift
+	}
+	return limit
+}
+
+// sweep 删除退避窗口结束已经超过 limit 的记录：这么久没有再失败的 key 重新从 base 开始退避，
+// 因此从不成功的 key 也不会让 failures 无限增长。下一次清理在记录数翻倍之后进行，均摊到每次 fail 是常数时间。调用方需持有 mu
+func (b *backoff) sweep(now time.Time) {
+	limit := b.limit()
+	for key, f := range b.failures {
+		if now.Sub(f.retryAt) > limit {
+			delete(b.failures, key)
+		}
+	}
+	b.sweepAt = max(2*len(b.failures), minSweepSize)
+}
+
+// succeed 加载成功后清除 key 的失败记录
+func (b *backoff) succeed(key string) {
+	if b.base <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.failures, key)
+}
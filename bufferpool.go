@@ -0,0 +1,39 @@
+package gee_cache
+
+import "sync"
+
+// 缓存值的缓冲区复用
+
+// bufferPool 复用固定容量的缓冲区，用于存放不超过 size 字节的缓存值，减少加载时的内存分配和 GC 压力
+type bufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+func newBufferPool(size int) *bufferPool {
+	p := &bufferPool{size: size}
+	p.pool.New = func() any {
+		b := make([]byte, size)
+		return &b
+	}
+	return p
+}
+
+// clone 与 cloneBytes 相同，不超过 size 字节的值使用池中的缓冲区。p 为 nil 时等同于 cloneBytes
+func (p *bufferPool) clone(b []byte) []byte {
+	if p == nil || len(b) > p.size {
+		return cloneBytes(b)
+	}
+	c := (*p.pool.Get().(*[]byte))[:len(b)]
+	copy(c, b)
+	return c
+}
+
+// put 归还一个已经离开缓存的值的缓冲区，容量不是 size 的缓冲区不是来自池中，直接丢弃
+func (p *bufferPool) put(b []byte) {
+	if p == nil || cap(b) != p.size {
+		return
+	}
+	b = b[:p.size]
+	p.pool.Put(&b)
+}
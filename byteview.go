@@ -1,12 +1,24 @@
 package gee_cache
 
+import "encoding/json"
+
 // 缓存值的抽象与封装
 
+// JSONUnmarshal 是 ByteView.Unmarshal 使用的解码函数，默认为 encoding/json，可以替换为更快的 JSON 库。
+// 替换的函数不能修改或者持有传入的字节切片。
+var JSONUnmarshal = json.Unmarshal
+
 // ByteView 包括一个只读的字节切片 b，b 被包装在 ByteView 中是为了防止缓存值被外部程序修改。
 type ByteView struct {
 	b []byte // b 将会存储真实的缓存值。选择 byte 类型是为了能够支持任意的数据类型的存储，例如字符串、图片等
 }
 
+// IsZero 判断是否为零值 ByteView{}，即“不存在”的值。
+// 缓存中长度为 0 的值内部是非 nil 的空切片，IsZero 返回 false，可以用来区分“空值”和“不存在”。
+func (v ByteView) IsZero() bool {
+	return v.b == nil
+}
+
 // Len 返回字节切片的长度
 func (v ByteView) Len() int {
 	return len(v.b)
@@ -17,12 +29,25 @@ func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
 }
 
+// AppendTo 将缓存值追加到 dst 中并返回追加后的切片，可以复用同一个缓冲区拼接多个值，避免 ByteSlice 的拷贝
+// append 会拷贝数据，修改返回的切片不会影响缓存值
+func (v ByteView) AppendTo(dst []byte) []byte {
+	return append(dst, v.b...)
+}
+
 // String 返回字符串
 func (v ByteView) String() string {
 	return string(v.b)
 }
 
+// Unmarshal 将缓存值按 JSON 解码到 dst 中
+// 解码不会持有输入，因此直接使用内部的字节切片，省去 ByteSlice 的拷贝
+func (v ByteView) Unmarshal(dst any) error {
+	return JSONUnmarshal(v.b, dst)
+}
+
 // cloneBytes 返回一个拷贝，防止缓存值被外部程序修改
+// 即使 b 为 nil 也返回非 nil 的空切片，保证缓存中的值不会是表示“不存在”的零值
 func cloneBytes(b []byte) []byte {
 	c := make([]byte, len(b))
 	copy(c, b)
@@ -0,0 +1,101 @@
+package gee_cache
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestByteViewUnmarshal(t *testing.T) {
+	v := ByteView{b: []byte(`{"name":"Tom","score":630}`)}
+	var s struct {
+		Name  string `json:"name"`
+		Score int    `json:"score"`
+	}
+	if err := v.Unmarshal(&s); err != nil || s.Name != "Tom" || s.Score != 630 {
+		t.Fatalf("unmarshal failed: %v %+v", err, s)
+	}
+
+	if err := (ByteView{b: []byte("{")}).Unmarshal(&s); err == nil {
+		t.Fatalf("expect error for invalid json")
+	}
+}
+
+func TestByteViewIsZero(t *testing.T) {
+	if !(ByteView{}).IsZero() {
+		t.Fatalf("zero ByteView should be zero")
+	}
+	if v := (ByteView{b: cloneBytes(nil)}); v.IsZero() || v.Len() != 0 {
+		t.Fatalf("empty value should not be zero")
+	}
+
+	gee := NewGroup("iszero", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return nil, nil }))
+	if v, _ := gee.Get(""); !v.IsZero() {
+		t.Fatalf("empty key should return the zero ByteView")
+	}
+	if v, err := gee.Get("empty"); err != nil || v.IsZero() {
+		t.Fatalf("empty value should not be zero")
+	}
+}
+
+func TestByteViewAppendTo(t *testing.T) {
+	v1, v2 := ByteView{b: []byte("Tom")}, ByteView{b: []byte("630")}
+	buf := v2.AppendTo(v1.AppendTo(make([]byte, 0, 8)))
+	if string(buf) != "Tom630" {
+		t.Fatalf("expect Tom630, but %s got", buf)
+	}
+	buf[0] = 't'
+	if v1.String() != "Tom" {
+		t.Fatalf("AppendTo should not expose the cached bytes")
+	}
+}
+
+func TestByteViewWire(t *testing.T) {
+	var buf bytes.Buffer
+	for _, s := range []string{"630", "", "589"} {
+		if err := WriteByteView(&buf, ByteView{b: []byte(s)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"630", "", "589"} {
+		v, err := ReadByteView(&buf)
+		if err != nil || v.String() != want || v.IsZero() {
+			t.Fatalf("ReadByteView = %q, %v, want %q", v.String(), err, want)
+		}
+	}
+	if _, err := ReadByteView(&buf); err != io.EOF {
+		t.Fatalf("expect io.EOF at the end, but %v got", err)
+	}
+
+	if _, err := ReadByteView(bytes.NewReader([]byte{0, 0, 0, 5, 'a'})); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect io.ErrUnexpectedEOF for truncated payload, but %v got", err)
+	}
+	if _, err := ReadByteView(bytes.NewReader([]byte{0, 0})); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect io.ErrUnexpectedEOF for truncated header, but %v got", err)
+	}
+	if _, err := ReadByteView(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff})); !errors.Is(err, ErrByteViewTooLarge) {
+		t.Fatalf("expect ErrByteViewTooLarge, but %v got", err)
+	}
+}
+
+func FuzzReadByteView(f *testing.F) {
+	f.Add([]byte{0, 0, 0, 3, '6', '3', '0'})
+	f.Add([]byte{0, 0, 0, 5, 'a'})
+	f.Add([]byte{0x03, 0xff, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, err := ReadByteView(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// 成功读到的值不会超过输入的长度，并且重新编码后与输入的前缀一致
+		if v.Len() > len(data)-4 || cap(v.b) > len(data) {
+			t.Fatalf("read %d bytes (cap %d) from %d bytes of input", v.Len(), cap(v.b), len(data))
+		}
+		var buf bytes.Buffer
+		if err := WriteByteView(&buf, v); err != nil || !bytes.HasPrefix(data, buf.Bytes()) {
+			t.Fatalf("round trip mismatch: %v", err)
+		}
+	})
+}
@@ -1,37 +1,639 @@
 package gee_cache
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"gee-cache/lru"
+	"strings"
 	"sync"
+	"time"
 )
 
 // 并发控制
 
 type cache struct {
 	mu         sync.Mutex
-	lru        *lru.Cache
+	lru        Policy
 	cacheBytes int64
+	// 大于 1 时从最久未使用的 evictCandidates 个条目中淘汰最大的一个
+	evictCandidates int
+	// 可选，创建淘汰策略的函数，为 nil 时使用 lru.Cache
+	newPolicy func(maxBytes int64, onEvicted func(key string, value lru.Value)) Policy
+	// 可选，条目被淘汰时的回调函数，在释放锁之后调用
+	onEvicted func(key string, value ByteView)
+	evicted   []evictedEntry // 持有锁期间被淘汰的条目，等待释放锁后批量回调
+	// 可选，通过 WithEvictionHandler 注册的回调函数，在 onEvicted 之后按注册顺序调用
+	evictionHandlers []evictionHandler
+
+	trackAge bool       // 是否记录条目的插入时间，用于统计被淘汰条目的存活时长
+	stats    cacheStats // 统计信息，在持有锁的情况下更新
+	// 可选，脏条目离开缓存之前的回写函数，在释放锁之后、onEvicted 之前调用
+	writeBack func(key string, value ByteView)
+	// 可选，条目被删除、淘汰或者覆盖时的回调函数，在释放锁之后调用
+	onInvalidate func(key string, reason InvalidationReason)
+	// 可选，条目被写入之后的回调函数，在释放锁之后调用
+	onAdd func(key string)
+	// 可选，复用缓存值的缓冲区，条目离开缓存并且所有回调都执行完之后归还
+	buffers *bufferPool
+
+	// 条目的过期时间，为 0 时永不过期。
+	// 超过 freshTTL 之后仍然返回旧值，但会在后台刷新；超过 hardTTL 之后视为未命中。
+	freshTTL time.Duration
+	hardTTL  time.Duration
+	// 条目从写入开始最长的存活时间，与 TTL 无关，超过之后一定视为未命中，为 0 时不限制
+	maxAge time.Duration
+
+	// 是否使用 key 的哈希值作为 lru 中的 key，原始的 key 保存在 item 中用于校验哈希冲突
+	hashKeys bool
+
+	// 可选，与其它 group 共享的缓存池。使用缓存池时 lru 和锁都来自缓存池，lru 中的 key 带有 prefix 前缀
+	pool   *CachePool
+	prefix string
+	// 可选，写时复制的缓存，不为 nil 时代替 lru 存放所有条目，读取不加锁，也不按容量淘汰
+	cow     *cowMap
+	entries int // 当前缓存的条目数
+	// 被同名的新 group 替换之后为 true，条目数的变化不再计入所有 group 的条目总数
+	untracked bool
+
+	version uint64 // 最近一次写入分配的版本号，每次写入加一
+	// 大于 0 时记录写入时间，并为每个 key 保留最近 versions 个版本（包括当前值），用于 GetVersion
+	versions int
 }
 
-func (c *cache) add(key string, value ByteView) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// Policy 是 cache 存放条目使用的淘汰策略，lru.Cache 和 lruk.Cache 都实现了它。
+// 与 lru.Cache 一样，并发安全由 cache 负责；OnEvicted 回调必须在内部状态都更新完成之后调用，Swap 替换旧值时不调用。
+type Policy interface {
+	lru.EvictionPolicy
+	Peek(key string) (value lru.Value, ok bool)                     // 查找一个 key，不影响淘汰顺序
+	Swap(key string, value lru.Value) (old lru.Value, existed bool) // 与 Add 相同，返回被替换的旧值
+	RemoveOldest()                                                  // 淘汰下一个应该被淘汰的记录
+	RemoveAndGet(key string) (value lru.Value, ok bool)             // 与 Remove 相同，返回被移除的值
+	Keys() []string                                                 // 按淘汰顺序的逆序返回所有 key，最后一个最先被淘汰
+	NewCursor() lru.Cursor                                          // 从最新写入的记录开始分批遍历，每批的开销与缓存的大小无关
+	SizeOf(key string) (int64, bool)                                // key 计入 Bytes 的字节数
+}
 
-	if c.lru == nil { // 延迟初始化，在第一次使用的时候初始化，减少内存占用
-		c.lru = lru.New(c.cacheBytes, nil)
+// item 是 cache 存入 lru 的值，在 ByteView 之外记录条目的元信息
+type item struct {
+	value ByteView
+	added time.Time // 插入时间，只有 trackAge 为 true 时才记录
+	dirty bool      // 是否有尚未回写的修改
+	meta  Meta      // 可选的元数据，写入之后不再修改
+
+	version uint64 // 写入时分配的版本号，同一个 cache 中严格递增，key 被淘汰后重新写入也不会重复
+
+	written time.Time     // 写入时间，只有 versions 大于 0 时才记录
+	history []pastVersion // 被覆盖的旧版本，从新到旧排列，最多 versions-1 个
+
+	freshUntil time.Time     // 在此之前是新鲜的，为零值时永远新鲜
+	expireAt   time.Time     // 在此之后视为未命中，为零值时永不过期
+	ttl        time.Duration // 写入之前设置，大于 0 时代替 cache 的 TTL，作为这个条目单一的过期时间
+
+	key string // 原始的 key，只有 hashKeys 为 true 或者使用缓存池时才记录
+
+	// 值是否已经交给了缓存之外的调用方（Get、Snapshot、回调等），交出去的缓冲区可能仍在被使用，不能归还到池中。
+	// 条目写入之后只能在持有锁的情况下修改
+	shared bool
+}
+
+// pastVersion 是一个被覆盖的旧版本
+type pastVersion struct {
+	value   ByteView
+	written time.Time
+}
+
+// Len 实现 lru.Value 接口，计算缓存值、元数据以及保留的旧版本的大小
+func (it *item) Len() int {
+	n := it.value.Len() + it.meta.size()
+	for _, v := range it.history {
+		n += v.value.Len()
 	}
-	c.lru.Add(key, value)
+	return n
+}
+
+// expired 判断条目在 now 时是否已经过期
+func (it *item) expired(now time.Time) bool {
+	return !it.expireAt.IsZero() && !now.Before(it.expireAt)
 }
 
-func (c *cache) get(key string) (value ByteView, ok bool) {
+// keyOf 返回条目原始的 key，stored 是条目在 lru 中的 key
+func (it *item) keyOf(stored string) string {
+	if it.key != "" {
+		return it.key
+	}
+	return stored
+}
+
+// hashedKeySize 是 hashKeys 为 true 时保留的 SHA-256 字节数，编码为十六进制后作为 lru 中的 key
+const hashedKeySize = 16
+
+// storeKey 返回 key 在 lru 中使用的 key
+func (c *cache) storeKey(key string) string {
+	if !c.hashKeys {
+		return c.prefix + key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return c.prefix + hex.EncodeToString(sum[:hashedKeySize])
+}
+
+// disabled 判断缓存是否被关闭（cacheBytes 为 0），关闭的缓存不存储任何条目。使用缓存池时容量由缓存池决定
+func (c *cache) disabled() bool {
+	return c.pool == nil && c.cow == nil && c.cacheBytes == 0
+}
+
+func (c *cache) lock() {
+	if c.pool != nil {
+		c.pool.mu.Lock()
+		c.pool.active = c
+		return
+	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
+}
 
+func (c *cache) unlock() {
+	if c.pool != nil {
+		c.pool.active = nil
+		c.pool.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+}
+
+// storedKeys 返回所有属于 c 的 lru 中的 key，按最近使用到最久未使用排序，调用方需持有锁
+func (c *cache) storedKeys() []string {
 	if c.lru == nil {
+		return nil
+	}
+	keys := c.lru.Keys()
+	if c.pool == nil {
+		return keys
+	}
+	own := keys[:0]
+	for _, key := range keys {
+		if strings.HasPrefix(key, c.prefix) {
+			own = append(own, key)
+		}
+	}
+	return own
+}
+
+// chunkWalk 记录 nextChunk 分批遍历的位置，调用方在两批之间释放锁
+type chunkWalk struct {
+	policy Policy
+	cur    lru.Cursor
+}
+
+// nextChunk 访问下一批最多 n 条记录中属于 c 的条目，调用方需持有锁，返回 false 表示已经遍历完。
+// 每批的开销只与 n 有关，与条目总数无关；lru 被整体替换（CommitRefresh）之后遍历提前结束
+func (c *cache) nextChunk(w *chunkWalk, n int, fn func(stored string, it *item)) bool {
+	if w.cur == nil {
+		if c.lru == nil {
+			return false
+		}
+		w.policy, w.cur = c.lru, c.lru.NewCursor()
+	}
+	if c.lru != w.policy {
+		w.cur.Close()
+		return false
+	}
+	return w.cur.Next(n, func(stored string, v lru.Value) {
+		if c.pool == nil || strings.HasPrefix(stored, c.prefix) {
+			fn(stored, v.(*item))
+		}
+	})
+}
+
+// lookup 查找 key 对应的条目，promote 表示是否更新最近使用时间，调用方需持有锁
+// 哈希冲突时（原始的 key 不一致）视为未命中
+func (c *cache) lookup(stored, key string, promote bool) (*item, bool) {
+	if c.lru == nil {
+		return nil, false
+	}
+	var v lru.Value
+	var ok bool
+	if promote {
+		v, ok = c.lru.Get(stored)
+	} else {
+		v, ok = c.lru.Peek(stored)
+	}
+	if !ok {
+		return nil, false
+	}
+	it := v.(*item)
+	if it.keyOf(stored) != key {
+		return nil, false
+	}
+	return it, true
+}
+
+// evictedEntry 记录一条被淘汰的缓存
+type evictedEntry struct {
+	key    string
+	item   *item
+	reason InvalidationReason // 条目离开缓存的原因
+	owner  *cache             // 条目所属的 cache，使用缓存池时可能是其它 group 的 cache
+}
+
+func (c *cache) add(key string, value ByteView) {
+	c.addItem(key, &item{value: value})
+}
+
+func (c *cache) addItem(key string, it *item) {
+	if c.cow != nil {
+		c.cowAdd(key, it)
 		return
 	}
-	if v, ok := c.lru.Get(key); ok {
-		return v.(ByteView), ok
+	c.lock()
+	evicted := c.addLocked(key, it)
+	c.unlock()
+
+	c.notifyEvicted(evicted)
+	c.notifyAdded(key)
+}
+
+// addLoaded 写入一个从 getter 或者 backend 加载的条目，返回交给加载的调用方的值，它的缓冲区不会再归还到池中。
+// key 当前的条目有尚未回写的修改时，加载的值比它旧（可能是回写之前的后端数据），不会覆盖它，返回的是当前的值
+func (c *cache) addLoaded(key string, it *item) ByteView {
+	it.shared = true
+	if c.cow != nil {
+		c.cowAdd(key, it)
+		return it.value
+	}
+	c.lock()
+	if cur, ok := c.lookup(c.storeKey(key), key, false); ok && cur.dirty {
+		cur.shared = true
+		c.unlock()
+		return cur.value
+	}
+	evicted := c.addLocked(key, it)
+	c.unlock()
+
+	c.notifyEvicted(evicted)
+	c.notifyAdded(key)
+	return it.value
+}
+
+// notifyAdded 在释放锁之后调用 onAdd，关闭的缓存不会写入条目，因此也不会调用
+// 之后检查所有 group 的条目总数是否超过了 SetGlobalMaxEntries 设置的上限
+func (c *cache) notifyAdded(key string) {
+	if c.onAdd != nil && !c.disabled() {
+		c.onAdd(key)
+	}
+	enforceGlobalMaxEntries()
+}
+
+// removeOldest 因容量不足淘汰一个最久未使用的条目，返回是否淘汰了条目。使用缓存池时淘汰的是缓存池中最久未使用的条目
+// 已经不计入条目总数的 cache 不会淘汰，淘汰它无法让总数下降
+func (c *cache) removeOldest() bool {
+	c.lock()
+	if c.untracked || c.lru == nil || c.lru.Len() == 0 {
+		c.unlock()
+		return false
+	}
+	n := c.lru.Len()
+	c.lru.RemoveOldest()
+	removed := c.lru.Len() < n
+	evicted := c.takeEvicted(InvalidationEvicted)
+	recordEvictions(evicted)
+	c.unlock()
+
+	c.notifyEvicted(evicted)
+	return removed
+}
+
+// addLocked 写入一个条目，返回被淘汰和覆盖的条目，调用方需持有锁，并在释放锁之后调用 notifyEvicted
+func (c *cache) addLocked(key string, it *item) []evictedEntry {
+	if c.disabled() {
+		return nil
+	}
+	if c.lru == nil { // 延迟初始化，在第一次使用的时候初始化，减少内存占用
+		maxBytes := max(c.cacheBytes, 0) // lru 中 maxBytes 为 0 表示不限制容量
+		if c.newPolicy != nil {
+			c.lru = c.newPolicy(maxBytes, c.collectEvicted)
+		} else {
+			l := lru.New(maxBytes, c.collectEvicted)
+			l.EvictCandidates = c.evictCandidates
+			c.lru = l
+		}
+	}
+	if c.trackAge || c.hardTTL > 0 || c.maxAge > 0 || c.versions > 0 || it.ttl > 0 {
+		now := time.Now()
+		if c.trackAge {
+			it.added = now
+		}
+		if it.ttl > 0 {
+			it.freshUntil = now.Add(it.ttl)
+			it.expireAt = it.freshUntil.Add(c.staleWindow(it.ttl))
+		} else if c.hardTTL > 0 {
+			it.freshUntil = now.Add(c.freshTTL)
+			it.expireAt = now.Add(c.hardTTL)
+		}
+		if c.maxAge > 0 {
+			if limit := now.Add(c.maxAge); it.expireAt.IsZero() || it.expireAt.After(limit) {
+				it.expireAt = limit
+				it.freshUntil = minTime(it.freshUntil, limit)
+			}
+		}
+		if c.versions > 0 {
+			it.written = now
+		}
+	}
+	c.version++
+	it.version = c.version
+	stored := c.storeKey(key)
+	if c.versions > 1 { // 在插入之前保留旧版本，使插入时计算的字节数包括它们
+		if cur, ok := c.lookup(stored, key, false); ok {
+			history := make([]pastVersion, 0, c.versions-1)
+			history = append(history, pastVersion{cur.value, cur.written})
+			it.history = append(history, cur.history[:min(len(cur.history), c.versions-2)]...)
+		}
+	}
+	if c.hashKeys || c.pool != nil {
+		it.key = key
+	}
+	old, overwritten := c.lru.Swap(stored, it)
+	c.addEntries(1)
+	c.stats.addSize(it.value.Len())
+	evicted := c.takeEvicted(InvalidationEvicted) // add 中发生的淘汰都是因为容量不足
+	recordEvictions(evicted)
+	if overwritten {
+		old := old.(*item)
+		c.addEntries(-1)
+		c.stats.removeSize(old.value.Len())
+		evicted = append(evicted, evictedEntry{key: old.keyOf(stored), item: old, reason: InvalidationOverwritten, owner: c})
+	}
+	return evicted
+}
+
+// update 在持有锁的情况下读取 key 当前的条目（不存在时 cur 为 nil），用 fn 的返回值覆盖它
+// fn 返回错误时不做修改
+func (c *cache) update(key string, fn func(cur *item) (*item, error)) error {
+	if c.cow != nil {
+		return c.cowUpdate(key, fn)
+	}
+	c.lock()
+	cur, _ := c.lookup(c.storeKey(key), key, true)
+	it, err := fn(cur)
+	if err != nil {
+		c.unlock()
+		return err
+	}
+	evicted := c.addLocked(key, it)
+	c.unlock()
+
+	c.notifyEvicted(evicted)
+	c.notifyAdded(key)
+	return nil
+}
+
+// get 查找一个 key，stale 表示已经过了新鲜期需要刷新，已经过期的条目会被删除并视为未命中。
+// 有尚未回写的修改的条目比后端的数据新，不需要刷新
+func (c *cache) get(key string) (value ByteView, stale bool, ok bool) {
+	it, stale, ok := c.getItem(key)
+	if !ok {
+		return
+	}
+	return it.value, stale, true
+}
+
+// getItem 与 get 相同，返回整个条目，调用方不能修改它
+func (c *cache) getItem(key string) (it *item, stale bool, ok bool) {
+	if c.cow != nil {
+		it, ok = c.cowGet(key)
+		return it, false, ok
+	}
+	c.lock()
+	stored := c.storeKey(key)
+	it, ok = c.lookup(stored, key, true)
+	if !ok {
+		c.stats.misses++
+		c.unlock()
+		return
+	}
+	if it.expireAt.IsZero() {
+		it.shared = true
+		c.stats.hits++
+		c.unlock()
+		return it, false, true
+	}
+
+	now := time.Now()
+	if !now.Before(it.expireAt) {
+		c.stats.misses++
+		c.lru.Remove(stored)
+		evicted := c.takeEvicted(InvalidationExpired)
+		c.unlock()
+
+		c.notifyEvicted(evicted)
+		return nil, false, false
+	}
+	it.shared = true
+	c.stats.hits++
+	c.unlock()
+	return it, !it.dirty && !now.Before(it.freshUntil), true
+}
+
+// peek 查找一个 key，不更新其最近使用时间
+func (c *cache) peek(key string) (value ByteView, ok bool) {
+	if c.cow != nil {
+		it, ok := c.cowGet(key)
+		if !ok {
+			return ByteView{}, false
+		}
+		return it.value, true
+	}
+	c.lock()
+	defer c.unlock()
+
+	if it, ok := c.lookup(c.storeKey(key), key, false); ok {
+		it.shared = true
+		return it.value, ok
 	}
 	return
 }
+
+// sizeOf 返回 key 对应的条目计入容量的字节数，不更新其最近使用时间
+func (c *cache) sizeOf(key string) (int64, bool) {
+	if c.cow != nil {
+		it, ok := c.cowGet(key)
+		if !ok {
+			return 0, false
+		}
+		return int64(len(key) + it.Len()), true
+	}
+	c.lock()
+	defer c.unlock()
+
+	stored := c.storeKey(key)
+	if _, ok := c.lookup(stored, key, false); !ok {
+		return 0, false
+	}
+	return c.lru.SizeOf(stored)
+}
+
+func (c *cache) len() int {
+	if c.cow != nil {
+		return len(c.cow.load())
+	}
+	c.lock()
+	defer c.unlock()
+
+	return c.entries
+}
+
+// collectEvicted 作为 lru 的 OnEvicted 回调，在持有锁的情况下只收集被淘汰的条目
+func (c *cache) collectEvicted(key string, value lru.Value) {
+	c.collect(c, key, value.(*item))
+}
+
+// addEntries 更新条目数以及所有 group 的条目总数，调用方需持有锁
+func (c *cache) addEntries(delta int) {
+	c.entries += delta
+	if !c.untracked {
+		totalEntries.Add(int64(delta))
+	}
+}
+
+// collect 将属于 owner 的被淘汰的条目收集到 c（当前持有锁的 cache）中
+func (c *cache) collect(owner *cache, stored string, it *item) {
+	owner.addEntries(-1)
+	owner.stats.removeSize(it.value.Len())
+	c.evicted = append(c.evicted, evictedEntry{key: it.keyOf(stored), item: it, owner: owner})
+}
+
+// takeEvicted 取出已收集的淘汰条目并记录离开缓存的原因，调用方需持有锁
+func (c *cache) takeEvicted(reason InvalidationReason) []evictedEntry {
+	evicted := c.evicted
+	c.evicted = nil
+	for i := range evicted {
+		evicted[i].reason = reason
+	}
+	return evicted
+}
+
+// notifyEvicted 在释放锁之后按淘汰顺序（最久未使用的在前）调用回调函数，脏条目会先回写
+// 被覆盖的条目没有离开缓存，只会触发 onInvalidate 以及明确要求了 InvalidationOverwritten 的 evictionHandlers
+// 开启了缓冲区复用时，值从来没有交给缓存之外（包括这些回调）的条目在回调结束之后归还缓冲区，包括被覆盖的条目
+// 使用缓存池时，条目的回调函数由其所属的 cache 决定
+func (c *cache) notifyEvicted(evicted []evictedEntry) {
+	for _, e := range evicted {
+		owner := e.owner
+		shared := e.item.shared
+		if e.reason != InvalidationOverwritten {
+			if e.item.dirty && owner.writeBack != nil {
+				owner.writeBack(e.key, e.item.value)
+				shared = true
+			}
+			if owner.onEvicted != nil {
+				owner.onEvicted(e.key, e.item.value)
+				shared = true
+			}
+		}
+		for _, h := range owner.evictionHandlers {
+			if h.reasons&(1<<e.reason) != 0 {
+				h.fn(e.key, e.item.value, e.reason)
+				shared = true
+			}
+		}
+		if owner.onInvalidate != nil {
+			owner.onInvalidate(e.key, e.reason)
+		}
+		// 被覆盖的值可能作为旧版本保留；写时复制的缓存读取不加锁，无法知道值是否已经交出去
+		if !shared && owner.cow == nil && (e.reason != InvalidationOverwritten || owner.versions <= 1) {
+			owner.buffers.put(e.item.value.b)
+		}
+	}
+}
+
+// replaceAll 在同一次加锁中删除所有不在 items 中的 key，并写入 items 中的所有条目，其它访问只能看到替换之前或者之后的内容
+func (c *cache) replaceAll(items map[string]*item) {
+	if c.cow != nil {
+		c.cowReplaceAll(items)
+		return
+	}
+	c.lock()
+	for _, stored := range c.storedKeys() {
+		v, _ := c.lru.Peek(stored)
+		if _, ok := items[v.(*item).keyOf(stored)]; !ok {
+			c.lru.Remove(stored)
+		}
+	}
+	evicted := c.takeEvicted(InvalidationDeleted)
+	for key, it := range items {
+		evicted = append(evicted, c.addLocked(key, it)...)
+	}
+	c.unlock()
+
+	c.notifyEvicted(evicted)
+	for key := range items {
+		c.notifyAdded(key)
+	}
+}
+
+// pop 删除 key 并返回它的值，已经过期的条目同样被删除，但视为不存在
+func (c *cache) pop(key string) (ByteView, bool) {
+	if c.cow != nil {
+		return c.cowPop(key)
+	}
+	c.lock()
+	stored := c.storeKey(key)
+	if _, ok := c.lookup(stored, key, false); !ok { // 哈希冲突时不能删除其它 key 的条目
+		c.unlock()
+		return ByteView{}, false
+	}
+	v, _ := c.lru.RemoveAndGet(stored)
+	it := v.(*item)
+	it.shared = true
+	reason := InvalidationDeleted
+	expired := it.expired(time.Now())
+	if expired {
+		reason = InvalidationExpired
+	}
+	evicted := c.takeEvicted(reason)
+	c.unlock()
+
+	c.notifyEvicted(evicted)
+	if expired {
+		return ByteView{}, false
+	}
+	return it.value, true
+}
+
+// removePrefix 删除所有以 prefix 开头的 key，返回删除的条目数
+func (c *cache) removePrefix(prefix string) int {
+	if c.cow != nil {
+		return c.cowRemovePrefix(prefix)
+	}
+	c.lock()
+	if c.lru == nil {
+		c.unlock()
+		return 0
+	}
+	n := 0
+	for _, stored := range c.storedKeys() {
+		v, _ := c.lru.Peek(stored)
+		if strings.HasPrefix(v.(*item).keyOf(stored), prefix) && c.lru.Remove(stored) {
+			n++
+		}
+	}
+	evicted := c.takeEvicted(InvalidationDeleted)
+	c.unlock()
+
+	c.notifyEvicted(evicted)
+	return n
+}
+
+func (c *cache) snapshotStats() Stats {
+	c.lock()
+	defer c.unlock()
+
+	return c.stats.snapshot()
+}
+
+// minTime 返回 a、b 中较早的一个，零值视为无穷晚
+func minTime(a, b time.Time) time.Time {
+	if a.IsZero() || b.Before(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,47 @@
+package gee_cache
+
+import "errors"
+
+// 基于版本号的比较并交换（compare-and-swap）
+
+// errVersionMismatch 表示 CompareAndSwap 时当前版本与期望的不一致，只在 update 的回调中使用
+var errVersionMismatch = errors.New("geecache: version mismatch")
+
+// GetWithVersion 只查询本地缓存，返回 key 的值以及它的版本号，不会调用 getter。
+// 每次写入（Set、加载、CompareAndSwap 等）都会分配一个新的、更大的版本号。
+func (g *Group) GetWithVersion(key string) (ByteView, uint64, bool) {
+	key = g.normalizeKey(key)
+	if key == "" {
+		return ByteView{}, 0, false
+	}
+	it, _, ok := g.mainCache.getItem(key)
+	if !ok {
+		return ByteView{}, 0, false
+	}
+	return it.value, it.version, true
+}
+
+// CompareAndSwap 只有当 key 当前的版本号等于 expectedVersion 时才写入 value，返回新的版本号以及是否写入成功，
+// 读取、比较和写入在同一次加锁中完成。expectedVersion 为 0 表示期望 key 不在缓存中。
+// 版本号在 key 被淘汰后重新写入时也不会重复，因此不会出现 ABA 问题；但被淘汰的 key 只能用 0 重新写入。
+func (g *Group) CompareAndSwap(key string, expectedVersion uint64, value []byte) (newVersion uint64, ok bool) {
+	key = g.normalizeKey(key)
+	if key == "" || g.closed.Load() {
+		return 0, false
+	}
+	it := &item{value: ByteView{b: cloneBytes(value)}}
+	err := g.mainCache.update(key, func(cur *item) (*item, error) {
+		var version uint64
+		if cur != nil {
+			version = cur.version
+		}
+		if version != expectedVersion {
+			return nil, errVersionMismatch
+		}
+		return it, nil
+	})
+	if err != nil {
+		return 0, false
+	}
+	return it.version, true
+}
@@ -0,0 +1,77 @@
+package gee_cache
+
+import (
+	"errors"
+	"time"
+)
+
+// Group 的关闭
+
+// ErrClosed 表示 Group 已经被关闭
+var ErrClosed = errors.New("geecache: group closed")
+
+// ErrCloseTimeout 表示 Close 等待进行中的加载超过了 WithCloseTimeout 设置的时间
+var ErrCloseTimeout = errors.New("geecache: close timed out with loads still in flight")
+
+// Close 按顺序关闭 group：
+//  1. 不再接受新的工作，之后的 Get 都返回 ErrClosed；
+//  2. 等待进行中的加载、后台刷新和预取结束，最多等待 WithCloseTimeout 设置的时间，超时时返回 ErrCloseTimeout；
+//  3. 配置了 WithWriteBack 时，将所有脏条目写入它的 Writer，写入失败的错误也会返回；
+//  4. 停止后台清理（StartJanitor），最后关闭所有订阅的 channel 和 Events 返回的事件流。
+//
+// 淘汰回调在释放锁之后同步调用，Close 返回时不会有尚未执行的回调。重复调用 Close 是安全的，返回第一次关闭的结果。
+func (g *Group) Close() error {
+	g.closeOnce.Do(func() {
+		g.closeMu.Lock()
+		g.closed.Store(true)
+		close(g.done)
+		g.closeMu.Unlock()
+
+		var errs []error
+		if !g.waitInFlight() {
+			errs = append(errs, ErrCloseTimeout)
+		}
+		if g.writer != nil {
+			errs = append(errs, g.FlushDirty(g.writer))
+		}
+		close(g.stopJanitor)
+		g.janitorWG.Wait()
+		g.subscribers.close()
+		g.events.close()
+		g.closeErr = errors.Join(errs...)
+	})
+	return g.closeErr
+}
+
+// track 登记一项进行中的工作，group 已经关闭时返回 false。返回 true 时调用方在工作结束后需要调用 g.wg.Done
+func (g *Group) track() bool {
+	g.closeMu.RLock()
+	defer g.closeMu.RUnlock()
+
+	if g.closed.Load() {
+		return false
+	}
+	g.wg.Add(1)
+	return true
+}
+
+// waitInFlight 等待所有进行中的工作结束，超过 closeTimeout 时返回 false，为 0 时一直等待
+func (g *Group) waitInFlight() bool {
+	if g.closeTimeout <= 0 {
+		g.wg.Wait()
+		return true
+	}
+	finished := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(finished)
+	}()
+	timer := time.NewTimer(g.closeTimeout)
+	defer timer.Stop()
+	select {
+	case <-finished:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
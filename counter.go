@@ -0,0 +1,63 @@
+package gee_cache
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 原子计数器
+
+// AddInt 将 key 的值按十进制整数加上 delta，存回缓存并返回新值，读取、相加和写入在同一次加锁中完成。
+// key 不在缓存中时先通过 getter 加载作为初始值，getter 应当为还不存在的计数器返回 "0"。
+// 当前的值不是合法的 int64 时返回错误，缓存不做修改。与 Get 一样先经过 WithValidator 的校验，
+// 只读模式下 key 不在缓存中时返回 ErrReadOnlyMiss，不会加载。
+func (g *Group) AddInt(key string, delta int64) (int64, error) {
+	key = g.normalizeKey(key)
+	if g.closed.Load() {
+		return 0, ErrClosed
+	}
+	if key == "" {
+		return 0, errors.New("geecache: empty key")
+	}
+	if g.validate != nil {
+		if err := g.validate(key); err != nil {
+			return 0, err
+		}
+	}
+
+	base, _, ok := g.mainCache.get(key)
+	if !ok {
+		if g.readOnly.Load() {
+			return 0, ErrReadOnlyMiss
+		}
+		var err error
+		if base, err = g.load(key); err != nil {
+			return 0, err
+		}
+	}
+
+	var n int64
+	err := g.mainCache.update(key, func(cur *item) (*item, error) {
+		it := &item{}
+		if cur != nil && !cur.dirty && cur.expired(time.Now()) { // 已经过期的计数器视为不存在，尚未回写的修改仍然以它为准
+			cur = nil
+		}
+		if cur != nil { // 加载之后可能已经被修改或者淘汰，以缓存中的值为准
+			base = cur.value
+			it.dirty = cur.dirty
+		}
+		old, err := strconv.ParseInt(base.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("geecache: value of %s is not an integer: %w", key, err)
+		}
+		n = old + delta
+		it.value = ByteView{b: strconv.AppendInt(nil, n, 10)}
+		return it, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,153 @@
+package gee_cache
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 写时复制的缓存：读取不加锁，适合很少更新的配置类数据
+
+// cowMap 保存一个不可变的 map，读取只需要一次原子读取，每次写入都复制整个 map 再替换指针
+type cowMap struct {
+	mu sync.Mutex // 串行化写入
+	m  atomic.Pointer[map[string]*item]
+}
+
+// load 返回当前的 map，调用方不能修改它
+func (m *cowMap) load() map[string]*item {
+	if p := m.m.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// modify 复制当前的 map，用 fn 修改副本之后替换，调用方需持有 mu
+func (m *cowMap) modify(fn func(next map[string]*item)) {
+	cur := m.load()
+	next := make(map[string]*item, len(cur)+1)
+	for k, v := range cur {
+		next[k] = v
+	}
+	fn(next)
+	m.m.Store(&next)
+}
+
+// sortedKeys 返回 m 中所有的 key，按字典序排列
+func sortedKeys(m map[string]*item) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cowGet 不加锁地查找 key
+func (c *cache) cowGet(key string) (*item, bool) {
+	it, ok := c.cow.load()[key]
+	return it, ok
+}
+
+// cowAdd 写入一个条目，被覆盖的旧条目在替换之后回调
+func (c *cache) cowAdd(key string, it *item) {
+	c.cow.mu.Lock()
+	c.version++
+	it.version = c.version
+	old, overwritten := c.cow.load()[key]
+	c.cow.modify(func(next map[string]*item) { next[key] = it })
+	c.cow.mu.Unlock()
+
+	if overwritten {
+		c.notifyEvicted([]evictedEntry{{key: key, item: old, reason: InvalidationOverwritten, owner: c}})
+	}
+	c.notifyAdded(key)
+}
+
+// cowUpdate 与 update 相同，读取和写入之间持有写入的锁
+func (c *cache) cowUpdate(key string, fn func(cur *item) (*item, error)) error {
+	c.cow.mu.Lock()
+	cur := c.cow.load()[key]
+	it, err := fn(cur)
+	if err != nil {
+		c.cow.mu.Unlock()
+		return err
+	}
+	c.version++
+	it.version = c.version
+	c.cow.modify(func(next map[string]*item) { next[key] = it })
+	c.cow.mu.Unlock()
+
+	if cur != nil {
+		c.notifyEvicted([]evictedEntry{{key: key, item: cur, reason: InvalidationOverwritten, owner: c}})
+	}
+	c.notifyAdded(key)
+	return nil
+}
+
+// cowRemoveIf 从 next 中删除所有满足 remove 的 key，返回删除的条目
+func (c *cache) cowRemoveIf(next map[string]*item, remove func(key string) bool) []evictedEntry {
+	var evicted []evictedEntry
+	for key, it := range next {
+		if remove(key) {
+			delete(next, key)
+			evicted = append(evicted, evictedEntry{key: key, item: it, reason: InvalidationDeleted, owner: c})
+		}
+	}
+	return evicted
+}
+
+// cowReplaceAll 与 replaceAll 相同，新的 map 一次替换，读取只会看到替换之前或者之后的内容
+func (c *cache) cowReplaceAll(items map[string]*item) {
+	var evicted []evictedEntry
+	c.cow.mu.Lock()
+	c.cow.modify(func(next map[string]*item) {
+		evicted = c.cowRemoveIf(next, func(key string) bool { return items[key] == nil })
+		for key, it := range items {
+			c.version++
+			it.version = c.version
+			if old, ok := next[key]; ok {
+				evicted = append(evicted, evictedEntry{key: key, item: old, reason: InvalidationOverwritten, owner: c})
+			}
+			next[key] = it
+		}
+	})
+	c.cow.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+	for key := range items {
+		c.notifyAdded(key)
+	}
+}
+
+// cowRemovePrefix 与 removePrefix 相同
+func (c *cache) cowRemovePrefix(prefix string) int {
+	var evicted []evictedEntry
+	c.cow.mu.Lock()
+	c.cow.modify(func(next map[string]*item) {
+		evicted = c.cowRemoveIf(next, func(key string) bool { return strings.HasPrefix(key, prefix) })
+	})
+	c.cow.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+	return len(evicted)
+}
+
+// cowPop 与 pop 相同
+func (c *cache) cowPop(key string) (ByteView, bool) {
+	var evicted []evictedEntry
+	c.cow.mu.Lock()
+	if _, ok := c.cow.load()[key]; ok {
+		c.cow.modify(func(next map[string]*item) {
+			evicted = c.cowRemoveIf(next, func(k string) bool { return k == key })
+		})
+	}
+	c.cow.mu.Unlock()
+
+	if len(evicted) == 0 {
+		return ByteView{}, false
+	}
+	c.notifyEvicted(evicted)
+	return evicted[0].item.value, true
+}
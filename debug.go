@@ -0,0 +1,53 @@
+package gee_cache
+
+import "encoding/json"
+
+// 调试信息
+
+// debugInfo 是 DebugJSON 输出的内容
+type debugInfo struct {
+	Name string `json:"name"`
+	// 使用缓存池时是缓存池的容量和用量，由所有共享缓存池的 group 共同占用
+	CacheBytes int64    `json:"cacheBytes"`
+	UsedBytes  int64    `json:"usedBytes"`
+	Pooled     bool     `json:"pooled"`
+	Items      int      `json:"items"`
+	ReadOnly   bool     `json:"readOnly"`
+	Closed     bool     `json:"closed"`
+	Stats      Stats    `json:"stats"`
+	Keys       []string `json:"keys,omitempty"`
+}
+
+// DebugJSON 以 JSON 格式输出 group 的内部状态，包括名称、容量和已使用的字节数、条目数以及统计信息，方便排查线上问题。
+// 为了避免泄露数据，输出中永远不包含值；withKeys 为 true 时额外输出所有 key（与 Keys 相同）。
+func (g *Group) DebugJSON(withKeys bool) ([]byte, error) {
+	info := debugInfo{
+		Name:     g.name,
+		ReadOnly: g.readOnly.Load(),
+		Closed:   g.closed.Load(),
+		Stats:    g.Stats(),
+	}
+	c := &g.mainCache
+	c.lock()
+	info.CacheBytes = c.cacheBytes
+	if c.lru != nil {
+		info.UsedBytes = c.lru.Bytes()
+	}
+	if c.pool != nil {
+		info.Pooled = true
+		info.CacheBytes = c.pool.lru.MaxBytes()
+	}
+	info.Items = c.entries
+	c.unlock()
+	if c.cow != nil {
+		cur := c.cow.load()
+		for key, it := range cur {
+			info.UsedBytes += int64(len(key) + it.Len())
+		}
+		info.Items = len(cur)
+	}
+	if withKeys {
+		info.Keys = g.Keys()
+	}
+	return json.Marshal(info)
+}
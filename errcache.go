@@ -0,0 +1,94 @@
+package gee_cache
+
+import (
+	"sync"
+	"time"
+)
+
+// 加载错误的短暂缓存
+
+// CachedError 包装了一次被缓存的加载错误，errors.Is/errors.As 仍然可以匹配原始错误
+type CachedError struct {
+	Err error
+}
+
+func (e *CachedError) Error() string {
+	return "geecache: cached load error: " + e.Err.Error()
+}
+
+// Unwrap 返回原始错误
+func (e *CachedError) Unwrap() error {
+	return e.Err
+}
+
+// errorCache 在 ttl 内缓存 key 的加载错误，ttl 为 0 时不启用
+type errorCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	errors  map[string]cachedErr
+	sweepAt int // errors 中的记录数达到 sweepAt 时清理过期的记录
+}
+
+type cachedErr struct {
+	err      error
+	expireAt time.Time
+}
+
+// get 返回 key 仍在有效期内的加载错误，否则返回 nil
+func (ec *errorCache) get(key string) error {
+	if ec.ttl <= 0 {
+		return nil
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	ce, ok := ec.errors[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(ce.expireAt) {
+		delete(ec.errors, key)
+		return nil
+	}
+	return &CachedError{Err: ce.err}
+}
+
+// add 缓存 key 的加载错误
+func (ec *errorCache) add(key string, err error) {
+	if ec.ttl <= 0 {
+		return
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	if ec.errors == nil {
+		ec.errors = make(map[string]cachedErr)
+	}
+	now := time.Now()
+	ec.errors[key] = cachedErr{err: err, expireAt: now.Add(ec.ttl)}
+	if len(ec.errors) >= ec.sweepAt {
+		ec.sweep(now)
+	}
+}
+
+// sweep 删除所有已经过期的错误，使不再被访问的 key（例如大量不同的不存在的 id）不会让 errors 无限增长。
+// 下一次清理在记录数翻倍之后进行，均摊到每次 add 是常数时间。调用方需持有 mu
+func (ec *errorCache) sweep(now time.Time) {
+	for key, ce := range ec.errors {
+		if now.After(ce.expireAt) {
+			delete(ec.errors, key)
+		}
+	}
+	ec.sweepAt = max(2*len(ec.errors), minSweepSize)
+}
+
+// remove 加载成功后清除 key 缓存的错误
+func (ec *errorCache) remove(key string) {
+	if ec.ttl <= 0 {
+		return
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	delete(ec.errors, key)
+}
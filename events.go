@@ -0,0 +1,138 @@
+package gee_cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 缓存事件流，用于把命中、加载和淘汰等原始事件导出到外部的分析管道
+
+// EventType 是事件的类型
+type EventType int
+
+const (
+	EventHit       EventType = iota // Get 命中缓存
+	EventMiss                       // Get 未命中缓存
+	EventLoadStart                  // 开始一次加载，合并的并发请求只有一次
+	EventLoadDone                   // 加载结束，Duration 和 Err 是加载的耗时和结果
+	EventEviction                   // 条目离开缓存，Reason 是离开的原因，被覆盖的条目不会产生这个事件
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventHit:
+		return "hit"
+	case EventMiss:
+		return "miss"
+	case EventLoadStart:
+		return "load-start"
+	case EventLoadDone:
+		return "load-done"
+	case EventEviction:
+		return "eviction"
+	}
+	return "unknown"
+}
+
+// Event 是 Events 发送的一个事件
+type Event struct {
+	Type     EventType
+	Key      string
+	Time     time.Time          // 事件发生的时间
+	Duration time.Duration      // 只对 EventLoadDone 有效
+	Err      error              // 只对 EventLoadDone 有效
+	Reason   InvalidationReason // 只对 EventEviction 有效
+}
+
+// eventBuffer 是事件 channel 的缓冲区大小
+const eventBuffer = 1024
+
+// eventStream 是 group 的事件流，第一次调用 Events 时才开启
+type eventStream struct {
+	mu      sync.RWMutex
+	on      atomic.Bool // 是否已经开启，未开启时 emit 不需要加锁
+	ch      chan Event
+	closed  bool
+	dropped atomic.Int64 // 因缓冲区已满被丢弃的事件数
+}
+
+// Events 开启并返回 group 的事件流，多次调用返回同一个 channel。未调用 Events 时不会产生任何事件，Get 只多一次原子读取。
+// 发送事件不会阻塞：channel 的缓冲区满时新的事件会被丢弃，并计入 DroppedEvents，慢的消费者不会拖慢缓存。
+// 关闭 group 时 channel 会被关闭，关闭之后调用 Events 返回已关闭的 channel。
+func (g *Group) Events() <-chan Event {
+	return g.events.open()
+}
+
+// DroppedEvents 返回因事件流的缓冲区已满而被丢弃的事件数
+func (g *Group) DroppedEvents() int64 {
+	return g.events.dropped.Load()
+}
+
+func (s *eventStream) open() <-chan Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ch == nil {
+		s.ch = make(chan Event, eventBuffer)
+		if s.closed {
+			close(s.ch)
+			return s.ch
+		}
+		s.on.Store(true)
+	}
+	return s.ch
+}
+
+// emit 在事件流开启时发送事件，不会阻塞
+func (s *eventStream) emit(e Event) {
+	if !s.on.Load() {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return
+	}
+	e.Time = time.Now()
+	select {
+	case s.ch <- e:
+	default: // 缓冲区已满，丢弃事件
+		s.dropped.Add(1)
+	}
+}
+
+func (s *eventStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.on.Store(false)
+	if s.ch != nil {
+		close(s.ch)
+	}
+}
+
+// onInvalidate 是 cache 的 onInvalidate 回调，通知失效事件的订阅者，并发送淘汰事件
+func (g *Group) onInvalidate(key string, reason InvalidationReason) {
+	g.subscribers.publish(key, reason)
+	if reason != InvalidationOverwritten {
+		g.events.emit(Event{Type: EventEviction, Key: key, Reason: reason})
+	}
+}
+
+// observeLoad 调用 fn 加载 key，事件流开启时在前后发送加载开始和结束的事件
+func (g *Group) observeLoad(key string, fn func() (ByteView, error)) (ByteView, error) {
+	if !g.events.on.Load() {
+		return fn()
+	}
+	g.events.emit(Event{Type: EventLoadStart, Key: key})
+	start := time.Now()
+	value, err := fn()
+	g.events.emit(Event{Type: EventLoadDone, Key: key, Duration: time.Since(start), Err: err})
+	return value, err
+}
@@ -1,6 +1,12 @@
 package gee_cache
 
-import "sync"
+import (
+	"errors"
+	"gee-cache/singleflight"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // 负责与外部交互，控制缓存存储和获取的主流程
 
@@ -8,9 +14,44 @@ import "sync"
 // 一个 Group 可以认为是一个缓存的命名空间，每个 Group 拥有一个唯一的名称 name。
 // 比如可以创建三个 Group，缓存学生的成绩命名为 scores，缓存学生信息的命名为 info，缓存学生课程的命名为 courses。
 type Group struct {
-	name      string
-	getter    Getter // 缓存未命中时获取源数据的回调(callback)
-	mainCache cache  // 一开始实现的并发缓存
+	name       string
+	getter     Getter     // 缓存未命中时获取源数据的回调(callback)
+	mainCache  cache      // 一开始实现的并发缓存
+	backoff    backoff    // 加载失败后的退避，默认不开启
+	loadErrors errorCache // 加载错误的短暂缓存，默认不开启
+	backends   []Backend  // 可选，本地缓存与 getter 之间按顺序查询的外部缓存
+
+	validate    func(key string) error  // 可选，在 Get 的最开始校验 key
+	noCache     func(key string) bool   // 可选，返回 true 的 key 加载后不写入缓存
+	normalize   func(key string) string // 可选，所有接受 key 的方法都先将 key 转换为规范形式
+	maxValueLen int                     // 加载的值超过这个字节数时不拷贝也不缓存，为 0 时不限制
+	loadTimeout time.Duration           // 单次调用 getter 的最长时间，为 0 时不限制
+	loadBudget  time.Duration           // 一次加载（backend 加上 getter）的总时间，为 0 时不限制
+	refreshing  sync.Map                // 正在后台刷新的 key
+
+	loader      *singleflight.Group // 保证每个 key 同时只加载一次
+	forceLoader *singleflight.Group // ForceLoad 使用的 singleflight，不与 Get 的加载合并，保证拿到的是新加载的值
+
+	subscribers subscribers              // 失效事件的订阅者
+	events      eventStream              // 事件流，第一次调用 Events 时开启
+	waiters     waiters                  // Await 的等待者
+	recorder    atomic.Pointer[recorder] // 访问记录，为 nil 时不记录
+	accessLog   *accessLog               // 最近访问的环形缓冲区，为 nil 时不记录
+	sampleRate  float64                  // 开销较大的统计在多大比例的 Get 上执行，默认为 1
+
+	readOnly       atomic.Bool    // 只读模式下缓存未命中不会调用 load
+	janitorStarted atomic.Bool    // 是否已经启动了后台清理
+	closed         atomic.Bool    // Close 之后为 true，Get 返回 ErrClosed
+	closeOnce      sync.Once      // 保证 Close 只执行一次
+	done           chan struct{}  // Close 时关闭，通知所有后台 goroutine 退出
+	wg             sync.WaitGroup // 等待进行中的加载和后台 goroutine 退出
+
+	closeMu      sync.RWMutex   // 保证 track 中的 wg.Add 发生在 Close 的 wg.Wait 之前
+	closeTimeout time.Duration  // Close 等待进行中的加载的最长时间，为 0 时一直等待
+	closeErr     error          // 第一次 Close 的结果
+	writer       Writer         // WithWriteBack 设置的 Writer，Close 时用于写入所有脏条目
+	stopJanitor  chan struct{}  // Close 在等待加载结束之后关闭，通知后台清理退出
+	janitorWG    sync.WaitGroup // 等待后台清理退出
 }
 
 // Getter 从外部获取数据的接口
@@ -28,23 +69,98 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 }
 
 var (
-	mu     sync.RWMutex
-	groups = make(map[string]*Group)
+	mu        sync.RWMutex
+	groups    = make(map[string]*Group)
+	maxGroups int // groups 中最多的 group 数，为 0 时不限制
 )
 
+// ErrTooManyGroups 表示 group 的数量已经达到 SetMaxGroups 设置的上限
+var ErrTooManyGroups = errors.New("geecache: too many groups")
+
+// SetMaxGroups 设置最多可以创建的 group 数，超过之后 TryNewGroup 返回 ErrTooManyGroups，NewGroup 会 panic。
+// 用同名的 group 替换已有的 group 不会增加数量。n 为 0 时不限制，这也是默认值。
+// 已经创建的 group 不受影响，即使它们的数量已经超过 n。
+func SetMaxGroups(n int) {
+	mu.Lock()
+	maxGroups = n
+	mu.Unlock()
+}
+
+// UnlimitedBytes 作为 NewGroup 的 cacheBytes 时表示缓存不限制容量，任何负数都有同样的效果
+const UnlimitedBytes int64 = -1
+
 // NewGroup 创建一个新的 Group 实例，并且将 group 存储在全局变量 groups 中
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+// cacheBytes 决定缓存的容量：
+//   - 大于 0：最多使用 cacheBytes 字节，超出时淘汰最久未使用的条目；
+//   - 等于 0：关闭缓存，Get 总是未命中并调用 getter，加载到的值不会写入缓存；
+//   - 小于 0（例如 UnlimitedBytes）：不限制容量，永远不会因为容量不足淘汰条目。
+//
+// group 的数量达到 SetMaxGroups 设置的上限时会 panic，需要处理这种情况时使用 TryNewGroup。
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...Option) *Group {
+	g, err := TryNewGroup(name, cacheBytes, getter, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// TryNewGroup 与 NewGroup 相同，但 group 的数量达到上限时返回 ErrTooManyGroups，而不是 panic
+func TryNewGroup(name string, cacheBytes int64, getter Getter, opts ...Option) (*Group, error) {
 	if getter == nil {
 		panic("nil Getter")
 	}
 	mu.Lock()
 	defer mu.Unlock()
+	return newGroupLocked(name, cacheBytes, getter, opts)
+}
+
+// newGroupLocked 创建 group 并存储在 groups 中，调用方需持有 mu
+func newGroupLocked(name string, cacheBytes int64, getter Getter, opts []Option) (*Group, error) {
+	if _, ok := groups[name]; !ok && maxGroups > 0 && len(groups) >= maxGroups {
+		return nil, ErrTooManyGroups
+	}
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
+		name:        name,
+		getter:      getter,
+		mainCache:   cache{cacheBytes: cacheBytes},
+		loader:      &singleflight.Group{},
+		forceLoader: &singleflight.Group{},
+		done:        make(chan struct{}),
+		stopJanitor: make(chan struct{}),
+		sampleRate:  1,
+	}
+	g.mainCache.onInvalidate = g.onInvalidate
+	g.mainCache.onAdd = g.waiters.wake
+	for _, opt := range opts {
+		opt(g)
+	}
+	if p := g.mainCache.pool; p != nil {
+		p.register(&g.mainCache, name)
+	}
+	if old, ok := groups[name]; ok {
+		old.mainCache.untrack()
 	}
 	groups[name] = g
+	return g, nil
+}
+
+// LoadOrCreateGroup 返回名为 name 的 group，不存在时创建它，查找和创建在同一次加锁中完成，
+// 并发调用时只会创建一次。getter 是 Getter 的工厂函数，只有需要创建 group 时才会调用，调用时持有全局的锁，
+// 因此不能在其中创建或者查找 group。group 的数量达到上限时与 NewGroup 一样会 panic。
+func LoadOrCreateGroup(name string, cacheBytes int64, getter func() Getter, opts ...Option) *Group {
+	mu.Lock()
+	defer mu.Unlock()
+	if g, ok := groups[name]; ok {
+		return g
+	}
+	gt := getter()
+	if gt == nil {
+		panic("nil Getter")
+	}
+	g, err := newGroupLocked(name, cacheBytes, gt, opts)
+	if err != nil {
+		panic(err)
+	}
 	return g
 }
 
@@ -56,35 +172,397 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// ErrReadOnlyMiss 表示 group 处于只读模式，且 key 不在缓存中，或者调用了需要加载的 ForceLoad
+var ErrReadOnlyMiss = errors.New("geecache: read-only group cache miss")
+
+// SetReadOnly 设置 group 是否处于只读模式。
+// 只读模式下已缓存的 key 照常返回，未命中的 key 不会调用 getter，而是返回 ErrReadOnlyMiss，用于维护期间冻结缓存内容。
+func (g *Group) SetReadOnly(ro bool) {
+	g.readOnly.Store(ro)
+}
+
 // Get 从缓存中查找一个值，如果不存在则调用 load 方法获取
+// 注意：空的 key 直接返回空值；而 getter 返回的长度为 0 的值与其他值一样会被缓存，后续 Get 不会再次调用 getter。
 func (g *Group) Get(key string) (ByteView, error) {
+	key = g.normalizeKey(key)
+	if g.closed.Load() {
+		return ByteView{}, ErrClosed
+	}
 	if key == "" {
 		return ByteView{}, nil
 	}
+	if g.validate != nil {
+		if err := g.validate(key); err != nil {
+			return ByteView{}, err
+		}
+	}
+
+	if l := g.accessLog; l != nil && g.sampled() {
+		start := time.Now()
+		v, hit, err := g.get(key)
+		l.add(key, hit, start)
+		return v, err
+	}
+	v, _, err := g.get(key)
+	return v, err
+}
+
+// GetUnsafe 与 Get 相同，但直接返回缓存内部的字节切片，省去 ByteSlice 的拷贝，只用于性能关键的只读路径。
+// 返回的切片与缓存共享存储：调用方绝对不能修改它。
+func (g *Group) GetUnsafe(key string) ([]byte, error) {
+	v, err := g.Get(key)
+	return v.b, err
+}
+
+// get 查找缓存并在未命中时加载，hit 表示是否命中缓存
+func (g *Group) get(key string) (value ByteView, hit bool, err error) {
+	if v, stale, ok := g.mainCache.get(key); ok {
+		g.recordAccess(recordHit, key)
+		if stale { // 过了新鲜期，先返回旧值，再在后台刷新
+			g.refresh(key)
+		}
+		return v, true, nil
+	}
+	g.recordAccess(recordMiss, key)
+	if g.readOnly.Load() {
+		return ByteView{}, false, ErrReadOnlyMiss
+	}
 
-	if v, ok := g.mainCache.get(key); ok {
+	value, err = g.load(key)
+	return value, false, err
+}
+
+// GetWith 与 Get 相同，但未命中时调用 loader 而不是 group 的 getter，加载的值仍然缓存在 key 下，
+// 用于结果依赖于 key 之外的参数的加载。不同的调用可能传入不同的 loader，因此 GetWith 的加载不经过 singleflight 合并，
+// 并发未命中的调用各自调用自己的 loader，缓存中保留最后写入的值。它不查询外部缓存，但加载的值与 getter 加载的一样写入外部缓存；
+// 过了新鲜期的条目直接返回，不会在后台刷新：刷新使用的是 group 的 getter。
+func (g *Group) GetWith(key string, loader func(key string) ([]byte, error)) (ByteView, error) {
+	key = g.normalizeKey(key)
+	if g.closed.Load() {
+		return ByteView{}, ErrClosed
+	}
+	if key == "" {
+		return ByteView{}, nil
+	}
+	if g.validate != nil {
+		if err := g.validate(key); err != nil {
+			return ByteView{}, err
+		}
+	}
+
+	if v, _, ok := g.mainCache.get(key); ok {
+		g.recordAccess(recordHit, key)
 		return v, nil
 	}
+	g.recordAccess(recordMiss, key)
+	if g.readOnly.Load() {
+		return ByteView{}, ErrReadOnlyMiss
+	}
+	if !g.track() {
+		return ByteView{}, ErrClosed
+	}
+	defer g.wg.Done()
+	return g.observeLoad(key, func() (ByteView, error) { return g.loadFrom(GetterFunc(loader), key) })
+}
 
-	return g.load(key)
+// GetStale 只从缓存中查找一个值，返回值以及是否存在，不会触发 load，即使条目已经过期也会返回。
+// 它也不会更新条目的最近使用时间，只读的尽力而为访问不会影响淘汰顺序。
+func (g *Group) GetStale(key string) (ByteView, bool) {
+	key = g.normalizeKey(key)
+	if key == "" {
+		return ByteView{}, false
+	}
+	return g.mainCache.peek(key)
+}
+
+// ErrCacheMiss 表示 key 不在缓存中
+var ErrCacheMiss = errors.New("geecache: cache miss")
+
+// GetCacheOnly 只从缓存中查找一个值，不存在时返回 ErrCacheMiss，永远不会调用 getter，也不会触发后台刷新。
+// 与 GetStale 不同，它遵守过期时间：已经过期的条目视为未命中。
+func (g *Group) GetCacheOnly(key string) (ByteView, error) {
+	key = g.normalizeKey(key)
+	if g.closed.Load() {
+		return ByteView{}, ErrClosed
+	}
+	if key == "" {
+		return ByteView{}, ErrCacheMiss
+	}
+	if v, _, ok := g.mainCache.get(key); ok {
+		return v, nil
+	}
+	return ByteView{}, ErrCacheMiss
 }
 
 // load 调用 getLocally（分布式场景下会调用 getFromPeer 从其他节点获取）获取源数据，并且将源数据添加到缓存 mainCache 中
+// 如果配置了外部缓存 backend，会先查询 backend
 func (g *Group) load(key string) (value ByteView, err error) {
-	return g.getLocally(key)
+	// 每个 key 同时只加载一次，并发的请求共享同一次加载的结果
+	viewi, err := g.loader.Do(key, func() (interface{}, error) {
+		if !g.track() {
+			return ByteView{}, ErrClosed
+		}
+		defer g.wg.Done()
+		return g.observeLoad(key, func() (ByteView, error) { return g.doLoad(key) })
+	})
+	if err == singleflight.ErrTimeout {
+		return ByteView{}, ErrLoadTimeout
+	}
+	if err != nil {
+		return ByteView{}, err
+	}
+	return viewi.(ByteView), nil
+}
+
+// InFlight 返回正在加载的 key 的数量，包括 Get 和 ForceLoad 触发的加载，用于监控
+func (g *Group) InFlight() int {
+	return g.loader.InFlight() + g.forceLoader.InFlight()
+}
+
+func (g *Group) doLoad(key string) (value ByteView, err error) {
+	if err := g.loadErrors.get(key); err != nil {
+		return ByteView{}, err
+	}
+	if err := g.backoff.check(key); err != nil {
+		return ByteView{}, err
+	}
+	var deadline time.Time // 所有阶段共享的截止时间，为零值时不限制
+	if g.loadBudget > 0 {
+		deadline = time.Now().Add(g.loadBudget)
+	}
+	if len(g.backends) > 0 && g.cacheable(key) {
+		value, ok, err := g.getFromBackends(key, deadline)
+		if err != nil {
+			return ByteView{}, err
+		}
+		if ok {
+			return value, nil
+		}
+	}
+
+	value, err = g.getLocally(key, deadline)
+	if err != nil {
+		// 超时的 getter 仍在执行，成功后会写入缓存，不能让缓存的错误或者退避挡住这个值
+		if !errors.Is(err, ErrLoadTimeout) && !errors.Is(err, ErrDeadlineExceeded) {
+			g.loadErrors.add(key, err)
+			g.backoff.fail(key, err)
+		}
+		return ByteView{}, err
+	}
+	g.loadErrors.remove(key)
+	g.backoff.succeed(key)
+	return value, nil
 }
 
+// ForceLoad 跳过缓存直接调用 getter 重新加载 key，并用新值覆盖缓存，保证返回的是新加载的值。
+// 与 Get 一样先经过 WithValidator 的校验，只读模式下不会加载，返回 ErrReadOnlyMiss。
+// key 有 SetDirty 写入、尚未回写的修改时不覆盖它，返回的是这个修改
+// 并发的 ForceLoad 会合并为一次加载，但不会与 Get 触发的加载合并
+func (g *Group) ForceLoad(key string) (ByteView, error) {
+	key = g.normalizeKey(key)
+	if g.closed.Load() {
+		return ByteView{}, ErrClosed
+	}
+	if key == "" {
+		return ByteView{}, nil
+	}
+	if g.validate != nil {
+		if err := g.validate(key); err != nil {
+			return ByteView{}, err
+		}
+	}
+	if g.readOnly.Load() {
+		return ByteView{}, ErrReadOnlyMiss
+	}
+
+	viewi, err := g.forceLoader.Do(key, func() (interface{}, error) {
+		if !g.track() {
+			return ByteView{}, ErrClosed
+		}
+		defer g.wg.Done()
+		return g.observeLoad(key, func() (ByteView, error) { return g.getLocally(key, time.Time{}) })
+	})
+	if err == singleflight.ErrTimeout {
+		return ByteView{}, ErrLoadTimeout
+	}
+	if err != nil {
+		return ByteView{}, err
+	}
+	return viewi.(ByteView), nil
+}
+
+// ErrLoadTimeout 表示 getter 在 loadTimeout 内没有返回，或者合并等待的加载超过了 WithMaxInFlight 设置的时间
+var ErrLoadTimeout = errors.New("geecache: load timeout")
+
+// ErrDeadlineExceeded 表示一次加载的各个阶段用完了 loadBudget
+var ErrDeadlineExceeded = errors.New("geecache: load deadline exceeded")
+
 // getLocally 通过回调函数 g.getter.Get() 获取源数据，并且将源数据添加到缓存 mainCache 中
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+// 设置了 loadTimeout 时，getter 超时会返回 ErrLoadTimeout，但 getter 会继续执行，成功后仍然写入缓存，避免浪费这次加载
+// deadline 不为零值时，getter 最多执行到 deadline，超时返回 ErrDeadlineExceeded
+func (g *Group) getLocally(key string, deadline time.Time) (ByteView, error) {
+	timeout, timeoutErr := g.loadTimeout, ErrLoadTimeout
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return ByteView{}, ErrDeadlineExceeded
+		}
+		if timeout <= 0 || remaining < timeout {
+			timeout, timeoutErr = remaining, ErrDeadlineExceeded
+		}
+	}
+	if timeout <= 0 {
+		return g.getFromGetter(key)
+	}
+	return runWithin(g, timeout, timeoutErr, func() (ByteView, error) {
+		return g.getFromGetter(key)
+	})
+}
+
+// runWithin 在后台 goroutine 中执行 fn，最多等待 timeout，超时返回 timeoutErr。
+// 超时之后 fn 会继续执行直到返回，它的 goroutine 由 g.wg 跟踪，调用方必须是已经通过 track 登记的工作。
+func runWithin[T any](g *Group, timeout time.Duration, timeoutErr error, fn func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+	ch := make(chan result, 1) // 带缓冲，超时之后 fn 的 goroutine 也能正常退出
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		value, err := fn()
+		ch <- result{value, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-ch:
+		return r.value, r.err
+	case <-timer.C:
+		var zero T
+		return zero, timeoutErr
+	}
+}
+
+// getFromGetter 调用 getter 获取源数据，并且将源数据添加到缓存 mainCache 和所有外部缓存 backends 中
+// noCache 判定为不可缓存的 key 只返回源数据，不写入任何一层缓存
+// getter 实现了 ContentTypeGetter 或者 TTLContentTypeGetter 时，返回的内容类型保存在条目的元数据中
+func (g *Group) getFromGetter(key string) (ByteView, error) {
+	return g.loadFrom(g.getter, key)
+}
+
+// loadFrom 与 getFromGetter 相同，使用 getter 代替 group 的 getter
+func (g *Group) loadFrom(getter Getter, key string) (ByteView, error) {
+	var bytes []byte
+	var contentType string
+	var ttl time.Duration
+	var err error
+	switch getter := getter.(type) {
+	case TTLContentTypeGetter:
+		bytes, contentType, ttl, err = getter.GetWithTTLAndContentType(key)
+	case TTLGetter:
+		bytes, ttl, err = getter.GetWithTTL(key)
+	case ContentTypeGetter:
+		bytes, contentType, err = getter.GetWithContentType(key)
+	default:
+		bytes, err = getter.Get(key)
+	}
 	if err != nil {
 		return ByteView{}, err
 	}
-	value := ByteView{b: cloneBytes(bytes)}
-	g.populateCache(key, value)
+	if g.oversized(bytes) { // 在拷贝之前拒绝，避免为不会缓存的值分配内存
+		return ByteView{b: bytes}, nil
+	}
+	if !g.cacheable(key) {
+		return ByteView{b: cloneBytes(bytes)}, nil
+	}
+	it := &item{value: ByteView{b: g.mainCache.buffers.clone(bytes)}, ttl: ttl}
+	if contentType != "" {
+		it.meta = Meta{MetaContentType: contentType}
+	}
+	value := g.mainCache.addLoaded(key, it)
+	g.setToBackends(g.backends, key, value)
 	return value, nil
 }
 
+// Set 直接将一个值写入缓存，覆盖已有的值
+func (g *Group) Set(key string, value []byte) {
+	key = g.normalizeKey(key)
+	if key == "" {
+		return
+	}
+	g.populateCache(key, ByteView{b: g.mainCache.buffers.clone(value)})
+}
+
+// ReplaceAll 用 m 替换缓存中的所有内容，用于整体刷新数据：不在 m 中的 key 被删除，m 中的 key 被写入或者覆盖。
+// 替换在同一次加锁中完成，并发的 Get 只会看到完整的旧数据或者完整的新数据。被删除的条目会触发淘汰回调，
+// m 超过缓存容量时，超出的部分与写入时一样被淘汰。替换期间会持有锁，m 很大时会阻塞其它访问。
+func (g *Group) ReplaceAll(m map[string][]byte) {
+	items := make(map[string]*item, len(m))
+	for key, value := range m {
+		if key = g.normalizeKey(key); key != "" {
+			items[key] = &item{value: ByteView{b: g.mainCache.buffers.clone(value)}}
+		}
+	}
+	g.mainCache.replaceAll(items)
+}
+
+// Pop 从缓存中删除 key 并返回它的值，key 不在缓存中（包括已经过期）时返回 false，不会触发 load。
+// 查找和删除在同一次加锁中完成，不会与并发的写入交错；被删除的条目与 DeletePrefix 一样触发淘汰回调。
+func (g *Group) Pop(key string) (ByteView, bool) {
+	key = g.normalizeKey(key)
+	return g.mainCache.pop(key)
+}
+
+// DeletePrefix 删除所有以 prefix 开头的 key，返回删除的条目数，被删除的条目会触发淘汰回调
+// prefix 不是完整的 key，不会经过 WithNormalizer 设置的转换，需要调用方自己使用规范形式
+// 删除期间会持有锁遍历整个缓存，适用于不频繁的批量失效场景
+func (g *Group) DeletePrefix(prefix string) int {
+	return g.mainCache.removePrefix(prefix)
+}
+
+// normalizeKey 返回 key 的规范形式，没有设置 normalize 时原样返回
+func (g *Group) normalizeKey(key string) string {
+	if g.normalize == nil {
+		return key
+	}
+	return g.normalize(key)
+}
+
+// oversized 判断加载的值是否超过了 WithMaxValueBytes 设置的上限
+func (g *Group) oversized(b []byte) bool {
+	return g.maxValueLen > 0 && len(b) > g.maxValueLen
+}
+
+// cacheable 判断 key 加载后是否可以写入缓存，没有设置 noCache 时所有 key 都可以缓存
+func (g *Group) cacheable(key string) bool {
+	return g.noCache == nil || !g.noCache(key)
+}
+
 func (g *Group) populateCache(key string, value ByteView) {
 	g.mainCache.add(key, value)
 }
+
+// SizeOf 返回 key 对应的条目计入缓存容量的字节数（key 的长度加上值和元数据的大小），key 不在缓存中时返回 false。
+// 它不会更新条目的最近使用时间。使用 WithHashedKeys 或者缓存池时，key 的长度按实际存储的 key 计算。
+func (g *Group) SizeOf(key string) (int64, bool) {
+	key = g.normalizeKey(key)
+	return g.mainCache.sizeOf(key)
+}
+
+// Len 返回 group 当前缓存的条目数
+func (g *Group) Len() int {
+	return g.mainCache.len()
+}
+
+// Keys 返回 group 当前缓存的所有 key 的快照，按最近使用到最久未使用排序
+// 使用 WithHashedKeys 时返回的是 key 的哈希值
+func (g *Group) Keys() []string {
+	return g.mainCache.keys()
+}
+
+// IsEmpty 判断 group 当前是否没有缓存任何条目
+func (g *Group) IsEmpty() bool {
+	return g.Len() == 0
+}
@@ -1,10 +1,23 @@
 package gee_cache
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"gee-cache/lru"
+	"gee-cache/lruk"
 )
 
 func TestGetter(t *testing.T) {
@@ -64,3 +77,2076 @@ func TestGetGroup(t *testing.T) {
 		t.Fatalf("expect nil, but %s got", group.name)
 	}
 }
+
+func TestGroupLen(t *testing.T) {
+	gee := NewGroup("len", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	if !gee.IsEmpty() || gee.Len() != 0 {
+		t.Fatalf("new group should be empty")
+	}
+	for _, k := range []string{"a", "b", "c"} {
+		_, _ = gee.Get(k)
+	}
+	if gee.IsEmpty() || gee.Len() != 3 {
+		t.Fatalf("expect 3 entries, but %d got", gee.Len())
+	}
+}
+
+func TestOnEvicted(t *testing.T) {
+	var keys []string
+	var gee *Group
+	gee = NewGroup("evicted", 8, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }),
+		WithOnEvicted(func(key string, value ByteView) {
+			keys = append(keys, key)
+			gee.Len() // 回调在释放锁之后调用，重入缓存不会死锁
+		}))
+	for _, k := range []string{"k1", "k2", "k3", "key4"} {
+		_, _ = gee.Get(k)
+	}
+
+	expect := []string{"k1", "k2", "k3"}
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("expect evicted keys %v, but %v got", expect, keys)
+	}
+}
+
+func TestGetEmptyValue(t *testing.T) {
+	loads := 0
+	gee := NewGroup("empty", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte{}, nil
+		}))
+
+	for i := 0; i < 2; i++ {
+		if view, err := gee.Get("empty"); err != nil || view.Len() != 0 {
+			t.Fatalf("failed to get empty value")
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("empty value should be cached, but getter called %d times", loads)
+	}
+}
+
+func TestLoadBackoff(t *testing.T) {
+	loads := 0
+	gee := NewGroup("backoff", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return nil, fmt.Errorf("%s broken", key)
+		}), WithLoadBackoff(20*time.Millisecond, 40*time.Millisecond))
+
+	for i := 0; i < 3; i++ {
+		if _, err := gee.Get("bad"); err == nil {
+			t.Fatalf("expect load error")
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expect getter called once within backoff window, but %d got", loads)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if _, err := gee.Get("bad"); err == nil || loads != 2 {
+		t.Fatalf("expect retry after backoff window, getter called %d times", loads)
+	}
+}
+
+func TestLoadBackoffBounds(t *testing.T) {
+	b := backoff{base: time.Second}
+	for _, attempts := range []int{40, 63, 64, 1000} {
+		if d := b.delay(attempts); d != defaultMaxBackoff {
+			t.Fatalf("delay(%d) = %v, want the default cap %v", attempts, d, defaultMaxBackoff)
+		}
+	}
+	if d := b.delay(3); d != 4*time.Second {
+		t.Fatalf("delay(3) = %v, want 4s", d)
+	}
+
+	// 从不成功的 key 在退避结束足够久之后会被清理
+	b = backoff{base: time.Microsecond, max: time.Microsecond}
+	for i := 0; i < 1000; i++ {
+		b.fail("k"+strconv.Itoa(i), errors.New("broken"))
+		if i%100 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if n := len(b.failures); n >= 1000 || n > 2*100+minSweepSize {
+		t.Fatalf("len(failures) = %d after 1000 distinct failing keys, want it bounded", n)
+	}
+}
+
+func TestErrorCacheBounded(t *testing.T) {
+	ec := errorCache{ttl: time.Microsecond}
+	for i := 0; i < 1000; i++ {
+		ec.add("k"+strconv.Itoa(i), errors.New("not found"))
+		if i%100 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if n := len(ec.errors); n > 2*100+minSweepSize {
+		t.Fatalf("len(errors) = %d after 1000 distinct failing keys, want it bounded", n)
+	}
+}
+
+type scoreCodec struct{}
+
+func (scoreCodec) Marshal(v int) ([]byte, error) {
+	return []byte(strconv.Itoa(v)), nil
+}
+
+func (scoreCodec) Unmarshal(data []byte) (int, error) {
+	return strconv.Atoi(string(data))
+}
+
+func TestTypedGroup(t *testing.T) {
+	tg := NewTypedGroup[int](NewGroup("typed", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("630"), nil })), scoreCodec{})
+
+	if v, err := tg.Get("Tom"); err != nil || v != 630 {
+		t.Fatalf("expect 630, but %d got (%v)", v, err)
+	}
+	if err := tg.Set("Jack", 589); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := tg.Get("Jack"); err != nil || v != 589 {
+		t.Fatalf("expect 589, but %d got (%v)", v, err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	gee := NewGroup("close", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	if _, err := gee.Get("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gee.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gee.Close(); err != nil {
+		t.Fatalf("close twice should be safe, but %v got", err)
+	}
+	if _, err := gee.Get("Tom"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expect ErrClosed, but %v got", err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	loads := 0
+	gee := NewGroup("readonly", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}))
+	_, _ = gee.Get("Tom")
+
+	gee.SetReadOnly(true)
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("cached key should be served in read-only mode")
+	}
+	if _, err := gee.Get("Jack"); !errors.Is(err, ErrReadOnlyMiss) || loads != 1 {
+		t.Fatalf("expect ErrReadOnlyMiss without loading, but %v got", err)
+	}
+	if _, err := gee.ForceLoad("Tom"); !errors.Is(err, ErrReadOnlyMiss) || loads != 1 {
+		t.Fatalf("expect ForceLoad to return ErrReadOnlyMiss without loading, but %v got", err)
+	}
+
+	gee.SetReadOnly(false)
+	if _, err := gee.Get("Jack"); err != nil || loads != 2 {
+		t.Fatalf("expect load after leaving read-only mode")
+	}
+}
+
+func TestDeletePrefix(t *testing.T) {
+	var evicted []string
+	gee := NewGroup("prefix", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }),
+		WithOnEvicted(func(key string, value ByteView) { evicted = append(evicted, key) }))
+	for _, k := range []string{"t1:a", "t1:b", "t2:a"} {
+		_, _ = gee.Get(k)
+	}
+
+	if n := gee.DeletePrefix("t1:"); n != 2 || len(evicted) != 2 || gee.Len() != 1 {
+		t.Fatalf("expect 2 keys deleted, but %d got", n)
+	}
+}
+
+func TestErrorTTL(t *testing.T) {
+	errBroken := errors.New("broken")
+	loads := 0
+	gee := NewGroup("errttl", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return nil, errBroken
+		}), WithErrorTTL(20*time.Millisecond))
+
+	_, _ = gee.Get("bad")
+	_, err := gee.Get("bad")
+	var cached *CachedError
+	if !errors.Is(err, errBroken) || !errors.As(err, &cached) || loads != 1 {
+		t.Fatalf("expect cached load error, but %v got", err)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if _, err := gee.Get("bad"); errors.As(err, &cached) || loads != 2 {
+		t.Fatalf("expect reload after error ttl, but %v got", err)
+	}
+}
+
+func TestGetStale(t *testing.T) {
+	loads := 0
+	gee := NewGroup("stale", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}))
+	if _, ok := gee.GetStale("Tom"); ok || loads != 0 {
+		t.Fatalf("GetStale should not load")
+	}
+	_, _ = gee.Get("Tom")
+	if v, ok := gee.GetStale("Tom"); !ok || v.String() != "Tom" {
+		t.Fatalf("GetStale should return cached value")
+	}
+}
+
+func TestEvictionAgeStats(t *testing.T) {
+	gee := NewGroup("evictionage", 8, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }),
+		WithEvictionAgeTracking())
+	_, _ = gee.Get("k1")
+	time.Sleep(10 * time.Millisecond)
+	_, _ = gee.Get("k2")
+	_, _ = gee.Get("k3")
+
+	st := gee.Stats()
+	if st.Evictions != 1 || st.EvictionAgeP50 < 10*time.Millisecond || st.EvictionAgeP99 < st.EvictionAgeP50 {
+		t.Fatalf("unexpected eviction stats %+v", st)
+	}
+}
+
+type mapBackend map[string][]byte
+
+func (b mapBackend) Get(key string) ([]byte, bool, error) {
+	v, ok := b[key]
+	return v, ok, nil
+}
+
+func (b mapBackend) Set(key string, value []byte) error {
+	b[key] = value
+	return nil
+}
+
+func TestBackend(t *testing.T) {
+	backend := mapBackend{"Tom": []byte("630")}
+	loads := 0
+	gee := NewGroup("backend", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("589"), nil
+		}), WithBackend(backend))
+
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "630" || loads != 0 {
+		t.Fatalf("expect value from backend without loading")
+	}
+	if v, err := gee.Get("Jack"); err != nil || v.String() != "589" || loads != 1 {
+		t.Fatalf("expect value from getter on backend miss")
+	}
+	if string(backend["Jack"]) != "589" {
+		t.Fatalf("value loaded from getter should be written to backend")
+	}
+}
+
+func TestLoadStages(t *testing.T) {
+	local := mapBackend{"Tom": []byte("630")}
+	regional := mapBackend{"Tom": []byte("stale"), "Jack": []byte("589")}
+	loads := 0
+	gee := NewGroup("loadstages", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("567"), nil
+		}), WithLoadStages(local, nil, regional))
+
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("Get(Tom) = %q, %v, want 630 from the first stage", v.String(), err)
+	}
+	if v, err := gee.Get("Jack"); err != nil || v.String() != "589" {
+		t.Fatalf("Get(Jack) = %q, %v, want 589 from the second stage", v.String(), err)
+	}
+	if string(local["Jack"]) != "589" {
+		t.Fatal("a hit in a later stage should fill the earlier stages")
+	}
+	if v, err := gee.Get("Sam"); err != nil || v.String() != "567" || loads != 1 {
+		t.Fatalf("Get(Sam) = %q, %v after %d loads, want 567 from the getter", v.String(), err, loads)
+	}
+	if string(local["Sam"]) != "567" || string(regional["Sam"]) != "567" {
+		t.Fatal("a value from the getter should be written to every stage")
+	}
+}
+
+func TestGetWith(t *testing.T) {
+	gee := NewGroup("getwith", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("default"), nil }))
+
+	release := make(chan struct{})
+	var started atomic.Int32
+	var wg sync.WaitGroup
+	results := make([]string, 2)
+	for i, name := range []string{"en", "fr"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := gee.GetWith("greeting", func(key string) ([]byte, error) {
+				started.Add(1)
+				<-release
+				return []byte(name), nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = v.String()
+		}()
+	}
+	for started.Load() != 2 { // 两个调用都未命中，各自调用了 loader
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if results[0] != "en" || results[1] != "fr" {
+		t.Fatalf("GetWith results = %v, want each call to see its own loader", results)
+	}
+
+	v, err := gee.GetWith("greeting", func(key string) ([]byte, error) {
+		t.Fatal("loader called on a hit")
+		return nil, nil
+	})
+	if err != nil || (v.String() != "en" && v.String() != "fr") {
+		t.Fatalf("GetWith on a hit = %q, %v", v.String(), err)
+	}
+	if v, _ := gee.Get("greeting"); v.String() == "default" {
+		t.Fatal("Get should see the value cached by GetWith")
+	}
+}
+
+func TestMaxValueBytes(t *testing.T) {
+	big := bytes.Repeat([]byte("x"), 64)
+	loads := 0
+	gee := NewGroup("maxvaluebytes", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			if key == "big" {
+				return big, nil
+			}
+			return []byte(key), nil
+		}), WithMaxValueBytes(16))
+
+	for i := 0; i < 2; i++ {
+		v, err := gee.GetUnsafe("big")
+		if err != nil || len(v) != len(big) {
+			t.Fatalf("GetUnsafe(big) = %d bytes, %v", len(v), err)
+		}
+		if &v[0] != &big[0] {
+			t.Fatal("oversized value should be returned without a copy")
+		}
+	}
+	if _, err := gee.Get("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if loads != 3 {
+		t.Fatalf("getter called %d times, want 3", loads)
+	}
+	if keys := gee.Keys(); !reflect.DeepEqual(keys, []string{"Tom"}) {
+		t.Fatalf("Keys() = %v, want [Tom]", keys)
+	}
+}
+
+func TestForceLoad(t *testing.T) {
+	score := "630"
+	gee := NewGroup("forceload", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(score), nil }))
+	_, _ = gee.Get("Tom")
+
+	score = "700"
+	if v, _ := gee.Get("Tom"); v.String() != "630" {
+		t.Fatalf("expect cached value 630, but %s got", v)
+	}
+	if v, err := gee.ForceLoad("Tom"); err != nil || v.String() != "700" {
+		t.Fatalf("expect fresh value 700, but %s got", v)
+	}
+	if v, _ := gee.Get("Tom"); v.String() != "700" {
+		t.Fatalf("ForceLoad should refresh the cache, but %s got", v)
+	}
+}
+
+func TestLoadKeepsDirtyEntry(t *testing.T) {
+	var mu sync.Mutex
+	var written []string
+	w := WriterFunc(func(key string, value []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		written = append(written, key+"="+string(value))
+		return nil
+	})
+	gee := NewGroup("loadkeepsdirty", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("old"), nil }),
+		WithTTL(5*time.Millisecond, time.Hour), WithWriteBack(w))
+
+	gee.SetDirty("k", []byte("new-write"))
+	time.Sleep(10 * time.Millisecond) // 过了新鲜期，但尚未回写的修改不需要刷新
+	if v, _ := gee.Get("k"); v.String() != "new-write" {
+		t.Fatalf("Get = %q, want the unflushed write", v.String())
+	}
+	if v, _ := gee.ForceLoad("k"); v.String() != "new-write" {
+		t.Fatalf("ForceLoad = %q, want the unflushed write", v.String())
+	}
+	if err := gee.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(written, []string{"k=new-write"}) {
+		t.Fatalf("written = %q, want the unflushed write", written)
+	}
+}
+
+func TestWriteBack(t *testing.T) {
+	store := make(map[string]string)
+	w := WriterFunc(func(key string, value []byte) error {
+		store[key] = string(value)
+		return nil
+	})
+	gee := NewGroup("writeback", 8, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }), WithWriteBack(w))
+
+	gee.SetDirty("k1", []byte("v1"))
+	gee.SetDirty("k2", []byte("v2"))
+	if err := gee.FlushDirty(w); err != nil || store["k1"] != "v1" || store["k2"] != "v2" {
+		t.Fatalf("flush dirty failed: %v %v", err, store)
+	}
+
+	delete(store, "k1")
+	delete(store, "k2")
+	gee.SetDirty("k3", []byte("v3")) // 淘汰 k1
+	if _, ok := store["k1"]; ok {
+		t.Fatalf("flushed entry should not be written again")
+	}
+	_, _ = gee.Get("key4") // 淘汰 k2、k3
+	if store["k3"] != "v3" {
+		t.Fatalf("dirty entry should be written back on eviction, got %v", store)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	gee := NewGroup("subscribe", 8, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	ch1, ch2 := gee.Subscribe(), gee.Subscribe()
+
+	_, _ = gee.Get("k1")
+	gee.Set("k1", []byte("v1"))
+	_, _ = gee.Get("k2")
+	_, _ = gee.Get("k3")
+	gee.DeletePrefix("k3")
+	if err := gee.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []InvalidationEvent{
+		{"k1", InvalidationOverwritten},
+		{"k1", InvalidationEvicted},
+		{"k3", InvalidationDeleted},
+	}
+	for _, ch := range []<-chan InvalidationEvent{ch1, ch2} {
+		var events []InvalidationEvent
+		for e := range ch {
+			events = append(events, e)
+		}
+		if !reflect.DeepEqual(expect, events) {
+			t.Fatalf("expect events %v, but %v got", expect, events)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	gee := NewGroup("events", 4, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "bad" {
+				return nil, errors.New("bad key")
+			}
+			return []byte(key), nil
+		}))
+	events := gee.Events()
+	if gee.Events() != events {
+		t.Fatal("Events() should return the same channel every time")
+	}
+
+	_, _ = gee.Get("k1")
+	_, _ = gee.Get("k1")
+	gee.Set("k1", []byte("v1")) // 覆盖不产生淘汰事件
+	_, _ = gee.Get("k2")
+	_, _ = gee.Get("bad")
+	if err := gee.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	type summary struct {
+		Type   EventType
+		Key    string
+		Failed bool
+		Reason InvalidationReason
+	}
+	var got []summary
+	for e := range events {
+		if e.Time.IsZero() {
+			t.Fatalf("event %v has no time", e)
+		}
+		got = append(got, summary{e.Type, e.Key, e.Err != nil, e.Reason})
+	}
+	want := []summary{
+		{Type: EventMiss, Key: "k1"},
+		{Type: EventLoadStart, Key: "k1"},
+		{Type: EventLoadDone, Key: "k1"},
+		{Type: EventHit, Key: "k1"},
+		{Type: EventMiss, Key: "k2"},
+		{Type: EventLoadStart, Key: "k2"},
+		{Type: EventEviction, Key: "k1", Reason: InvalidationEvicted},
+		{Type: EventLoadDone, Key: "k2"},
+		{Type: EventMiss, Key: "bad"},
+		{Type: EventLoadStart, Key: "bad"},
+		{Type: EventLoadDone, Key: "bad", Failed: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	if n := gee.DroppedEvents(); n != 0 {
+		t.Fatalf("DroppedEvents() = %d, want 0", n)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	gee := NewGroup("snapshot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	for _, k := range []string{"k1", "k2", "k3"} {
+		_, _ = gee.Get(k)
+	}
+
+	expect := []KeyValue{
+		{"k3", ByteView{b: []byte("k3")}},
+		{"k2", ByteView{b: []byte("k2")}},
+		{"k1", ByteView{b: []byte("k1")}},
+	}
+	if kvs := gee.Snapshot(); !reflect.DeepEqual(expect, kvs) {
+		t.Fatalf("expect snapshot %v, but %v got", expect, kvs)
+	}
+	if kvs := gee.SnapshotChunked(2); !reflect.DeepEqual(expect, kvs) {
+		t.Fatalf("expect chunked snapshot %v, but %v got", expect, kvs)
+	}
+	_, _ = gee.Get("k1") // 分批拷贝按写入顺序，访问不会改变 k1 的位置
+	if kvs := gee.SnapshotChunked(1); !reflect.DeepEqual(expect, kvs) {
+		t.Fatalf("expect chunked snapshot in write order %v, but %v got", expect, kvs)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	gee := NewGroup("record", 8, getter)
+
+	var buf bytes.Buffer
+	gee.StartRecording(&buf)
+	for _, k := range []string{"k1", "k2", "k1", "k3", "k1"} {
+		_, _ = gee.Get(k)
+	}
+	if err := gee.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = gee.Get("k4") // 停止之后不再记录
+
+	replay := NewGroup("replay", 8, getter)
+	if err := ReplayFrom(&buf, replay); err != nil {
+		t.Fatal(err)
+	}
+	expect := []KeyValue{
+		{"k1", ByteView{b: []byte("k1")}},
+		{"k3", ByteView{b: []byte("k3")}},
+	}
+	if kvs := replay.Snapshot(); !reflect.DeepEqual(expect, kvs) {
+		t.Fatalf("replay should reproduce cache contents %v, but %v got", expect, kvs)
+	}
+
+	if err := ReplayFrom(bytes.NewReader([]byte{recordHit, 5, 'k'}), replay); err == nil {
+		t.Fatalf("expect error for truncated record")
+	}
+	oversized := []byte("h\xff\xff\xff\xff\xff\xff\xff\xff\x7f")
+	if err := ReplayFrom(bytes.NewReader(oversized), replay); !errors.Is(err, ErrRecordKeyTooLarge) {
+		t.Fatalf("expect ErrRecordKeyTooLarge for an oversized key length, but %v got", err)
+	}
+	if err := ReplayFrom(bytes.NewReader([]byte{recordMiss, 0x81, 0x80, 0x04}), replay); !errors.Is(err, ErrRecordKeyTooLarge) {
+		t.Fatalf("expect ErrRecordKeyTooLarge for a key one byte over the limit, but %v got", err)
+	}
+}
+
+func TestLoadTimeout(t *testing.T) {
+	gee := NewGroup("loadtimeout", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			time.Sleep(30 * time.Millisecond)
+			return []byte(key), nil
+		}), WithLoadTimeout(10*time.Millisecond))
+
+	if _, err := gee.Get("Tom"); !errors.Is(err, ErrLoadTimeout) {
+		t.Fatalf("expect ErrLoadTimeout, but %v got", err)
+	}
+	if err := gee.Close(); err != nil { // 等待超时的 getter 执行结束
+		t.Fatal(err)
+	}
+	if v, ok := gee.GetStale("Tom"); !ok || v.String() != "Tom" {
+		t.Fatalf("timed out load should still populate the cache")
+	}
+}
+
+func TestLoadTimeoutNotCached(t *testing.T) {
+	var calls atomic.Int32
+	gee := NewGroup("loadtimeoutnotcached", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if calls.Add(1) == 1 { // 只有第一次加载超时
+				time.Sleep(30 * time.Millisecond)
+			}
+			return []byte(key), nil
+		}), WithLoadTimeout(10*time.Millisecond), WithErrorTTL(time.Minute), WithLoadBackoff(time.Minute, 0))
+
+	if _, err := gee.Get("Tom"); !errors.Is(err, ErrLoadTimeout) {
+		t.Fatalf("expect ErrLoadTimeout, but %v got", err)
+	}
+	for start := time.Now(); ; time.Sleep(5 * time.Millisecond) { // 等待超时的 getter 写入缓存
+		if _, ok := gee.GetStale("Tom"); ok || time.Since(start) > time.Second {
+			break
+		}
+	}
+	gee.Pop("Tom") // 重新加载时不能返回缓存的超时错误
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("Get after the timed out load finished = %q, %v, want the loaded value", v.String(), err)
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	release := make(chan struct{})
+	gee := NewGroup("maxinflight", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			<-release
+			return []byte(key), nil
+		}), WithMaxInFlight(20*time.Millisecond))
+
+	leader := make(chan error, 1)
+	go func() {
+		_, err := gee.Get("Tom")
+		leader <- err
+	}()
+	for gee.InFlight() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := gee.Get("Tom"); !errors.Is(err, ErrLoadTimeout) {
+		t.Fatalf("expect ErrLoadTimeout, but %v got", err)
+	}
+	if n := gee.InFlight(); n != 0 {
+		t.Fatalf("InFlight() = %d after timeout, want 0", n)
+	}
+
+	close(release)
+	if err := <-leader; err != nil {
+		t.Fatal(err)
+	}
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("Get(Tom) = %q, %v", v.String(), err)
+	}
+}
+
+type slowBackend struct{ delay time.Duration }
+
+func (b slowBackend) Get(key string) ([]byte, bool, error) {
+	time.Sleep(b.delay)
+	return nil, false, nil
+}
+
+func (b slowBackend) Set(key string, value []byte) error { return nil }
+
+func TestLoadBudget(t *testing.T) {
+	gee := NewGroup("loadbudget", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			time.Sleep(100 * time.Millisecond)
+			return []byte(key), nil
+		}), WithBackend(slowBackend{100 * time.Millisecond}), WithLoadBudget(150*time.Millisecond))
+
+	// backend 和 getter 单独都不会超时，加起来超过了预算
+	start := time.Now()
+	if _, err := gee.Get("Tom"); !errors.Is(err, ErrDeadlineExceeded) {
+		t.Fatalf("expect ErrDeadlineExceeded, but %v got", err)
+	}
+	if d := time.Since(start); d >= 190*time.Millisecond {
+		t.Fatalf("Get took %v, want about the 150ms budget", d)
+	}
+	if err := gee.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	var loads atomic.Int32
+	gee := NewGroup("ttl", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(strconv.Itoa(int(loads.Add(1)))), nil
+		}), WithTTL(20*time.Millisecond, 60*time.Millisecond))
+
+	if v, _ := gee.Get("Tom"); v.String() != "1" {
+		t.Fatalf("expect first load, but %s got", v)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if v, _ := gee.Get("Tom"); v.String() != "1" { // 过了新鲜期，返回旧值并在后台刷新
+		t.Fatalf("expect stale value, but %s got", v)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if v, _ := gee.Get("Tom"); v.String() != "2" {
+		t.Fatalf("expect refreshed value, but %s got", v)
+	}
+
+	time.Sleep(70 * time.Millisecond)
+	if v, _ := gee.Get("Tom"); v.String() != "3" { // 已经过期，视为未命中
+		t.Fatalf("expect expired entry to reload, but %s got", v)
+	}
+	_ = gee.Close()
+}
+
+func TestMaxAge(t *testing.T) {
+	var loads atomic.Int32
+	gee := NewGroup("maxage", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(strconv.Itoa(int(loads.Add(1)))), nil
+		}), WithTTL(time.Hour, time.Hour), WithMaxAge(20*time.Millisecond))
+
+	if v, _ := gee.Get("Tom"); v.String() != "1" {
+		t.Fatalf("expect first load, but %s got", v)
+	}
+	if v, _ := gee.Get("Tom"); v.String() != "1" {
+		t.Fatalf("expect cached value, but %s got", v)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if v, _ := gee.Get("Tom"); v.String() != "2" { // TTL 没有到，但超过了 maxAge
+		t.Fatalf("expect entry older than maxAge to reload, but %s got", v)
+	}
+	_ = gee.Close()
+}
+
+type ttlGetter struct{ loads *atomic.Int32 }
+
+func (g ttlGetter) Get(key string) ([]byte, error) {
+	v, _, err := g.GetWithTTL(key)
+	return v, err
+}
+
+func (g ttlGetter) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	n := g.loads.Add(1)
+	var ttl time.Duration
+	if key == "short" {
+		ttl = 20 * time.Millisecond
+	}
+	return []byte(strconv.Itoa(int(n))), ttl, nil
+}
+
+func TestTTLGetter(t *testing.T) {
+	var loads atomic.Int32
+	gee := NewGroup("ttlgetter", 2<<10, ttlGetter{&loads}, WithTTL(time.Hour, time.Hour))
+
+	short, _ := gee.Get("short")
+	long, _ := gee.Get("long")
+	time.Sleep(30 * time.Millisecond)
+	if v, _ := gee.Get("short"); v.String() == short.String() {
+		t.Fatalf("entry with a 20ms TTL from the getter should reload, but %s got again", v)
+	}
+	if v, _ := gee.Get("long"); v.String() != long.String() { // ttl 为 0 时使用 group 的 TTL
+		t.Fatalf("expect cached value %s, but %s got", long, v)
+	}
+	_ = gee.Close()
+}
+
+func TestTTLGetterStaleWindow(t *testing.T) {
+	var loads atomic.Int32
+	gee := NewGroup("ttlgetterstale", 2<<10, ttlGetter{&loads}, WithTTL(time.Hour, 3*time.Hour))
+
+	short, _ := gee.Get("short")
+	time.Sleep(30 * time.Millisecond)
+	// 20ms 的新鲜期按 WithTTL 的比例换算出 40ms 的刷新窗口，过了新鲜期仍然返回旧值
+	if v, err := gee.Get("short"); err != nil || v.String() != short.String() {
+		t.Fatalf("expect stale value %s within the refresh window, but %s, %v got", short, v, err)
+	}
+	for start := time.Now(); loads.Load() < 2; time.Sleep(time.Millisecond) { // 等待后台刷新
+		if time.Since(start) > time.Second {
+			t.Fatal("expect a background refresh within the refresh window")
+		}
+	}
+	_ = gee.Close()
+}
+
+type ttlContentTypeGetter struct{}
+
+func (ttlContentTypeGetter) Get(key string) ([]byte, error) {
+	v, _, _, err := ttlContentTypeGetter{}.GetWithTTLAndContentType(key)
+	return v, err
+}
+
+func (ttlContentTypeGetter) GetWithTTLAndContentType(key string) ([]byte, string, time.Duration, error) {
+	return []byte(key), "text/plain", 20 * time.Millisecond, nil
+}
+
+func TestTTLContentTypeGetter(t *testing.T) {
+	gee := NewGroup("ttlcontenttype", 2<<10, ttlContentTypeGetter{})
+
+	_, _ = gee.Get("Tom")
+	if ct, ok := gee.ContentType("Tom"); !ok || ct != "text/plain" {
+		t.Fatalf("expect text/plain, but %q got", ct)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := gee.GetCacheOnly("Tom"); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("entry should expire after the getter supplied TTL, but %v got", err)
+	}
+}
+
+func TestGroupKeys(t *testing.T) {
+	gee := NewGroup("keys", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	for _, k := range []string{"k1", "k2", "k3", "k1"} {
+		_, _ = gee.Get(k)
+	}
+	if keys := gee.Keys(); !reflect.DeepEqual(keys, []string{"k1", "k3", "k2"}) {
+		t.Fatalf("expect keys ordered by recency, but %v got", keys)
+	}
+}
+
+func TestHashedKeys(t *testing.T) {
+	var evicted []string
+	longKey := strings.Repeat("https://example.com/", 10)
+	gee := NewGroup("hashedkeys", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("v"), nil }),
+		WithHashedKeys(), WithOnEvicted(func(key string, value ByteView) { evicted = append(evicted, key) }))
+
+	_, _ = gee.Get(longKey)
+	if v, ok := gee.GetStale(longKey); !ok || v.String() != "v" {
+		t.Fatalf("hashed key lookup failed")
+	}
+	if keys := gee.Keys(); len(keys) != 1 || len(keys[0]) != 2*hashedKeySize {
+		t.Fatalf("expect hashed keys, but %v got", keys)
+	}
+	if kvs := gee.Snapshot(); kvs[0].Key != longKey {
+		t.Fatalf("snapshot should keep original keys")
+	}
+
+	// 模拟哈希冲突：另一个 key 映射到同一个哈希值
+	gee.mainCache.mu.Lock()
+	v, _ := gee.mainCache.lru.Peek(gee.mainCache.storeKey(longKey))
+	v.(*item).key = "other"
+	gee.mainCache.mu.Unlock()
+	if _, ok := gee.GetStale(longKey); ok {
+		t.Fatalf("hash collision should be treated as a miss")
+	}
+
+	if n := gee.DeletePrefix("other"); n != 1 || !reflect.DeepEqual(evicted, []string{"other"}) {
+		t.Fatalf("DeletePrefix should match original keys, evicted %v", evicted)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	errInvalid := errors.New("invalid key")
+	loads := 0
+	gee := NewGroup("validator", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}), WithValidator(func(key string) error {
+		if strings.ContainsAny(key, " /") {
+			return errInvalid
+		}
+		return nil
+	}))
+
+	if _, err := gee.Get("bad key"); !errors.Is(err, errInvalid) || loads != 0 || gee.Len() != 0 {
+		t.Fatalf("expect invalid key to be rejected, but %v got", err)
+	}
+	if _, err := gee.ForceLoad("bad key"); !errors.Is(err, errInvalid) || loads != 0 {
+		t.Fatalf("expect ForceLoad to reject invalid key, but %v got", err)
+	}
+	if _, err := gee.Get("Tom"); err != nil || loads != 1 {
+		t.Fatalf("expect valid key to load")
+	}
+}
+
+func TestSizeHistogram(t *testing.T) {
+	gee := NewGroup("sizehistogram", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }), WithSizeHistogram())
+	gee.Set("empty", nil)
+	for _, k := range []string{"a", "bb", "ccc", "dddd"} {
+		_, _ = gee.Get(k)
+	}
+	gee.Set("dddd", []byte("d"))
+	gee.DeletePrefix("ccc")
+
+	expect := []int64{1, 2, 1}
+	if st := gee.Stats(); !reflect.DeepEqual(expect, st.SizeHistogram) {
+		t.Fatalf("expect size histogram %v, but %v got", expect, st.SizeHistogram)
+	}
+}
+
+func TestOnEvictedReentrant(t *testing.T) {
+	var gee *Group
+	gee = NewGroup("reentrant", 12, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("vv"), nil }),
+		WithOnEvicted(func(key string, value ByteView) {
+			if key[0] != '~' {
+				gee.Set("~"+key, nil)
+			}
+		}))
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		_, _ = gee.Get(k)
+	}
+	if gee.mainCache.lru.Len() != len(gee.Keys()) || gee.Len() == 0 {
+		t.Fatalf("inconsistent cache after reentrant OnEvicted")
+	}
+}
+
+func TestGetCacheOnly(t *testing.T) {
+	loads := 0
+	gee := NewGroup("cacheonly", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}), WithTTL(10*time.Millisecond, 0))
+
+	if _, err := gee.GetCacheOnly("Tom"); !errors.Is(err, ErrCacheMiss) || loads != 0 {
+		t.Fatalf("expect ErrCacheMiss without loading, but %v got", err)
+	}
+	_, _ = gee.Get("Tom")
+	if v, err := gee.GetCacheOnly("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("expect cached value")
+	}
+	time.Sleep(15 * time.Millisecond)
+	if _, err := gee.GetCacheOnly("Tom"); !errors.Is(err, ErrCacheMiss) || loads != 1 {
+		t.Fatalf("expired entry should be a miss, but %v got", err)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	var evicted atomic.Int32
+	gee := NewGroup("janitor", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }),
+		WithTTL(10*time.Millisecond, 0),
+		WithOnEvicted(func(key string, value ByteView) { evicted.Add(1) }))
+	for i := 0; i < 600; i++ {
+		_, _ = gee.Get(strconv.Itoa(i))
+	}
+
+	gee.StartJanitor(5*time.Millisecond, 2)
+	time.Sleep(40 * time.Millisecond)
+	if gee.Len() != 0 || evicted.Load() != 600 {
+		t.Fatalf("expect janitor to remove expired entries, %d left", gee.Len())
+	}
+	_ = gee.Close()
+}
+
+func TestAddInt(t *testing.T) {
+	gee := NewGroup("counter", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "bad" {
+				return []byte("abc"), nil
+			}
+			return []byte("0"), nil
+		}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := gee.AddInt("hits", 2); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n, err := gee.AddInt("hits", -50); err != nil || n != 150 {
+		t.Fatalf("expect 150, but %d got (%v)", n, err)
+	}
+	if v, _ := gee.Get("hits"); v.String() != "150" {
+		t.Fatalf("expect stored value 150, but %s got", v)
+	}
+	if _, err := gee.AddInt("bad", 1); err == nil {
+		t.Fatalf("expect error for non-integer value")
+	}
+}
+
+func TestAddIntGuards(t *testing.T) {
+	errInvalid := errors.New("invalid key")
+	loads := 0
+	gee := NewGroup("counterguards", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("0"), nil
+		}), WithValidator(func(key string) error {
+		if strings.Contains(key, " ") {
+			return errInvalid
+		}
+		return nil
+	}))
+
+	if _, err := gee.AddInt("bad key", 1); !errors.Is(err, errInvalid) || loads != 0 {
+		t.Fatalf("expect invalid key to be rejected, but %v got", err)
+	}
+	gee.SetReadOnly(true)
+	if _, err := gee.AddInt("hits", 1); !errors.Is(err, ErrReadOnlyMiss) || loads != 0 {
+		t.Fatalf("expect ErrReadOnlyMiss without loading, but %v got", err)
+	}
+}
+
+func TestCachePool(t *testing.T) {
+	pool := NewCachePool(24) // 每个条目 "x\x00k?" + "vv" 为 6 字节，最多 4 个
+	var evicted []string
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte("vv"), nil })
+	a := NewGroup("a", 0, getter, WithCachePool(pool),
+		WithOnEvicted(func(key string, value ByteView) { evicted = append(evicted, "a:"+key) }))
+	b := NewGroup("b", 0, getter, WithCachePool(pool),
+		WithOnEvicted(func(key string, value ByteView) { evicted = append(evicted, "b:"+key) }))
+
+	_, _ = a.Get("k1")
+	_, _ = a.Get("k2")
+	_, _ = b.Get("k1") // 与 a 的 k1 不冲突
+	_, _ = b.Get("k2")
+	_, _ = a.Get("k1")
+	_, _ = b.Get("k3") // 淘汰整个缓存池中最久未使用的 a 的 k2
+
+	if !reflect.DeepEqual(evicted, []string{"a:k2"}) {
+		t.Fatalf("expect a:k2 evicted from the shared pool, but %v got", evicted)
+	}
+	if a.Len() != 1 || b.Len() != 3 {
+		t.Fatalf("expect a has 1 entry and b has 3, but %d and %d got", a.Len(), b.Len())
+	}
+	if keys := b.Keys(); !reflect.DeepEqual(keys, []string{"k3", "k2", "k1"}) {
+		t.Fatalf("expect keys without namespace, but %v got", keys)
+	}
+	if n := b.DeletePrefix("k"); n != 3 || a.Len() != 1 {
+		t.Fatalf("DeletePrefix should only touch its own group")
+	}
+}
+
+func TestCachePoolReplaceGroup(t *testing.T) {
+	isolateGroups(t)
+	pool := NewCachePool(0)
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte("v"), nil })
+	g1 := NewGroup("pooled", 0, getter, WithCachePool(pool))
+	_, _ = g1.Get("z")
+	_, _ = g1.Get("w")
+
+	g2 := NewGroup("pooled", 0, getter, WithCachePool(pool), WithSizeHistogram())
+	if g1.Len() != 0 || g2.Len() != 2 || !reflect.DeepEqual(g2.Keys(), []string{"w", "z"}) {
+		t.Fatalf("expect entries moved to the new group, but g1.Len() = %d, g2.Len() = %d, g2.Keys() = %v",
+			g1.Len(), g2.Len(), g2.Keys())
+	}
+	if n := g2.DeletePrefix(""); n != 2 || g2.Len() != 0 || g1.Len() != 0 {
+		t.Fatalf("expect both entries charged to the new group, but deleted %d, g2.Len() = %d, g1.Len() = %d",
+			n, g2.Len(), g1.Len())
+	}
+}
+
+func TestGetTyped(t *testing.T) {
+	gee := NewGroup("gettyped", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(`{"name":"Tom","score":630}`), nil }))
+	type student struct {
+		Name  string `json:"name"`
+		Score int    `json:"score"`
+	}
+	s, err := GetTyped(gee, "Tom", func(b []byte, s *student) error { return json.Unmarshal(b, s) })
+	if err != nil || s.Name != "Tom" || s.Score != 630 {
+		t.Fatalf("GetTyped failed: %v %+v", err, s)
+	}
+}
+
+func TestNoCache(t *testing.T) {
+	var calls atomic.Int32
+	gee := NewGroup("nocache", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			calls.Add(1)
+			return []byte(key), nil
+		}), WithNoCache(func(key string) bool { return strings.HasPrefix(key, "price:") }))
+
+	for i := 0; i < 2; i++ {
+		if v, err := gee.Get("price:AAPL"); err != nil || v.String() != "price:AAPL" {
+			t.Fatalf("Get(price:AAPL) = %q, %v", v.String(), err)
+		}
+		if _, err := gee.Get("Tom"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("getter called %d times, want 3", n)
+	}
+	if keys := gee.Keys(); !reflect.DeepEqual(keys, []string{"Tom"}) {
+		t.Fatalf("Keys() = %v, want [Tom]", keys)
+	}
+}
+
+func TestNormalizer(t *testing.T) {
+	var calls atomic.Int32
+	gee := NewGroup("normalize", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			calls.Add(1)
+			return []byte(key), nil
+		}), WithNormalizer(strings.ToLower))
+
+	for _, key := range []string{"Tom", "TOM", "tom"} {
+		if v, err := gee.Get(key); err != nil || v.String() != "tom" {
+			t.Fatalf("Get(%s) = %q, %v, want tom", key, v.String(), err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("getter called %d times, want 1", n)
+	}
+
+	gee.Set("Jack", []byte("630"))
+	if v, err := gee.GetCacheOnly("JACK"); err != nil || v.String() != "630" {
+		t.Fatalf("GetCacheOnly(JACK) = %q, %v", v.String(), err)
+	}
+	_, ver, ok := gee.GetWithVersion("jack")
+	if !ok {
+		t.Fatal("GetWithVersion(jack) missed")
+	}
+	if _, ok := gee.CompareAndSwap("JaCk", ver, []byte("631")); !ok {
+		t.Fatal("CompareAndSwap(JaCk) failed")
+	}
+	if keys := gee.Keys(); !reflect.DeepEqual(keys, []string{"jack", "tom"}) {
+		t.Fatalf("Keys() = %v, want [jack tom]", keys)
+	}
+}
+
+func TestGetWithMeta(t *testing.T) {
+	gee := NewGroup("meta", 20, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+
+	meta := Meta{"etag": "abcdefgh"}
+	gee.SetWithMeta("k1", []byte("v1"), meta)
+	meta["etag"] = "changed"
+	v, m, ok := gee.GetWithMeta("k1")
+	if !ok || v.String() != "v1" || m["etag"] != "abcdefgh" {
+		t.Fatalf("GetWithMeta(k1) = %q, %v, %v", v.String(), m, ok)
+	}
+	if _, m, ok := gee.GetWithMeta("unknown"); ok || m != nil {
+		t.Fatalf("GetWithMeta(unknown) = %v, %v, want miss", m, ok)
+	}
+
+	// k1 占用 2+2+4+8 个字节，元数据计入容量，写入 k2、k3 之后 k1 被淘汰
+	gee.Set("k2", []byte("v2"))
+	if n := gee.Len(); n != 2 {
+		t.Fatalf("Len() = %d, want 2", n)
+	}
+	gee.Set("k3", []byte("v3"))
+	if _, _, ok := gee.GetWithMeta("k1"); ok {
+		t.Fatal("k1 should be evicted when meta bytes are accounted")
+	}
+	if _, m, ok := gee.GetWithMeta("k2"); !ok || m != nil {
+		t.Fatalf("GetWithMeta(k2) = %v, %v, want nil meta", m, ok)
+	}
+}
+
+func TestCacheBytesStates(t *testing.T) {
+	var calls atomic.Int32
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		calls.Add(1)
+		return []byte("value"), nil
+	})
+
+	disabled := NewGroup("disabled", 0, getter)
+	for i := 0; i < 2; i++ {
+		if v, err := disabled.Get("Tom"); err != nil || v.String() != "value" {
+			t.Fatalf("Get(Tom) = %q, %v", v.String(), err)
+		}
+	}
+	disabled.Set("Jack", []byte("value"))
+	if n := calls.Load(); n != 2 || disabled.Len() != 0 {
+		t.Fatalf("disabled cache: getter called %d times, len %d, want 2 and 0", n, disabled.Len())
+	}
+
+	unlimited := NewGroup("unlimited", UnlimitedBytes, getter)
+	for i := 0; i < 100; i++ {
+		unlimited.Set(strconv.Itoa(i), bytes.Repeat([]byte("x"), 1<<10))
+	}
+	if n := unlimited.Len(); n != 100 {
+		t.Fatalf("unlimited cache len = %d, want 100", n)
+	}
+}
+
+func TestDebugJSON(t *testing.T) {
+	gee := NewGroup("debug", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("secret"), nil }))
+	if _, err := gee.Get("Tom"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := gee.DebugJSON(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("secret")) || bytes.Contains(b, []byte("Tom")) {
+		t.Fatalf("DebugJSON leaked data: %s", b)
+	}
+	var info struct {
+		Name       string
+		CacheBytes int64
+		UsedBytes  int64
+		Items      int
+		Keys       []string
+	}
+	if err := json.Unmarshal(b, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "debug" || info.CacheBytes != 2<<10 || info.UsedBytes != 9 || info.Items != 1 || info.Keys != nil {
+		t.Fatalf("DebugJSON(false) = %s", b)
+	}
+
+	b, _ = gee.DebugJSON(true)
+	if err := json.Unmarshal(b, &info); err != nil || !reflect.DeepEqual(info.Keys, []string{"Tom"}) {
+		t.Fatalf("DebugJSON(true) = %s", b)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	gee := NewGroup("cas", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("630"), nil }))
+
+	if _, ok := gee.CompareAndSwap("Tom", 1, []byte("1")); ok {
+		t.Fatal("CompareAndSwap on a missing key with version 1 should fail")
+	}
+	v1, ok := gee.CompareAndSwap("Tom", 0, []byte("1"))
+	if !ok || v1 == 0 {
+		t.Fatalf("CompareAndSwap(Tom, 0) = %d, %v", v1, ok)
+	}
+	v2, ok := gee.CompareAndSwap("Tom", v1, []byte("2"))
+	if !ok || v2 <= v1 {
+		t.Fatalf("CompareAndSwap(Tom, %d) = %d, %v", v1, v2, ok)
+	}
+	if _, ok := gee.CompareAndSwap("Tom", v1, []byte("3")); ok {
+		t.Fatal("CompareAndSwap with a stale version should fail")
+	}
+	if v, version, ok := gee.GetWithVersion("Tom"); !ok || version != v2 || v.String() != "2" {
+		t.Fatalf("GetWithVersion(Tom) = %q, %d, %v", v.String(), version, ok)
+	}
+
+	// 普通的写入也会分配新的版本号
+	gee.Set("Tom", []byte("4"))
+	if _, version, _ := gee.GetWithVersion("Tom"); version <= v2 {
+		t.Fatalf("Set should bump the version, got %d", version)
+	}
+	if _, ok := gee.CompareAndSwap("Tom", v2, []byte("5")); ok {
+		t.Fatal("CompareAndSwap after Set should fail")
+	}
+}
+
+func TestMaxGroups(t *testing.T) {
+	isolateGroups(t) // 同时在结束时恢复 maxGroups
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	SetMaxGroups(1)
+
+	if _, err := TryNewGroup("maxgroups", 2<<10, getter); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TryNewGroup("maxgroups", 2<<10, getter); err != nil { // 替换同名的 group 不增加数量
+		t.Fatalf("replacing a group should not count against the cap: %v", err)
+	}
+	if _, err := TryNewGroup("maxgroups2", 2<<10, getter); !errors.Is(err, ErrTooManyGroups) {
+		t.Fatalf("expect ErrTooManyGroups, but %v got", err)
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	var evicted []string
+	gee := NewGroup("bufferpool", 32, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("v" + key), nil }),
+		WithBufferPool(4), WithOnEvicted(func(key string, value ByteView) {
+			evicted = append(evicted, value.String()) // 回调期间值仍然有效
+		}))
+
+	v, _ := gee.Get("1")
+	if v.String() != "v1" || cap(v.b) != 4 {
+		t.Fatalf("Get(1) = %q with cap %d, want a pooled buffer", v.String(), cap(v.b))
+	}
+	gee.Set("long", []byte("too long for the pool"))
+	if v, ok := gee.GetStale("long"); !ok || cap(v.b) == 4 {
+		t.Fatal("values larger than the pool size should not use pooled buffers")
+	}
+	for _, key := range []string{"2", "3", "4"} {
+		if v, _ := gee.Get(key); v.String() != "v"+key {
+			t.Fatalf("Get(%s) = %q", key, v.String())
+		}
+	}
+	if !reflect.DeepEqual(evicted, []string{"v1", "too long for the pool"}) {
+		t.Fatalf("evicted = %q", evicted)
+	}
+}
+
+func TestBufferPoolLoadEvicted(t *testing.T) {
+	gee := NewGroup("bufferpoolevicted", 4, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("v" + key), nil }),
+		WithBufferPool(8))
+
+	// 值超过了缓存容量，写入时就被淘汰，返回给 Get 的缓冲区不能被复用
+	v, _ := gee.Get("abc")
+	if _, err := gee.Get("xyz"); err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "vabc" {
+		t.Fatalf("Get(abc) = %q after another load, want the loaded value", v.String())
+	}
+}
+
+func TestBufferPoolSharedValues(t *testing.T) {
+	gee := NewGroup("bufferpoolshared", 12, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("v" + key), nil }),
+		WithBufferPool(4))
+
+	a, _ := gee.Get("a")
+	gee.Set("b", []byte("vb"))
+	snapshot := gee.Snapshot()
+	for _, key := range []string{"c", "d", "e", "f"} { // 淘汰 a 和 b，新的值会从池中取缓冲区
+		gee.Set(key, []byte("v"+key))
+	}
+	if a.String() != "va" {
+		t.Fatalf("held Get value = %q after its entry left the cache, want %q", a.String(), "va")
+	}
+	for _, kv := range snapshot {
+		if kv.Value.String() != "v"+kv.Key {
+			t.Fatalf("held Snapshot value of %s = %q after its entry left the cache", kv.Key, kv.Value.String())
+		}
+	}
+}
+
+func BenchmarkGetWithBufferPool(b *testing.B) {
+	value := bytes.Repeat([]byte("x"), 512)
+	getter := GetterFunc(func(key string) ([]byte, error) { return value, nil })
+	for _, size := range []int{0, 512} {
+		b.Run("pool="+strconv.Itoa(size), func(b *testing.B) {
+			gee := NewGroup("benchbufferpool", 64<<10, getter, WithBufferPool(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				gee.Get(strconv.Itoa(i % 1024)) // 缓存只能容纳约 128 个值，大部分 Get 都会加载并淘汰
+			}
+		})
+	}
+}
+
+func TestEvictionHandlers(t *testing.T) {
+	var events []string
+	handler := func(name string) func(string, ByteView, InvalidationReason) {
+		return func(key string, _ ByteView, reason InvalidationReason) {
+			events = append(events, name+":"+key+":"+reason.String())
+		}
+	}
+	gee := NewGroup("evictionhandlers", 8, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }),
+		WithEvictionHandler(handler("metrics")),
+		WithEvictionHandler(handler("writeback"), InvalidationEvicted),
+		WithEvictionHandler(handler("overwrite"), InvalidationOverwritten))
+
+	gee.Set("k1", []byte("v1"))
+	gee.Set("k1", []byte("v2"))
+	gee.Set("k2", []byte("v2"))
+	gee.Set("k3", []byte("v3"))
+	gee.DeletePrefix("k")
+
+	want := []string{
+		"overwrite:k1:overwritten",
+		"metrics:k1:evicted", "writeback:k1:evicted",
+		"metrics:k3:deleted", "metrics:k2:deleted",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+}
+
+func TestSizeOf(t *testing.T) {
+	gee := NewGroup("sizeof", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	gee.Set("Tom", []byte("630"))
+	gee.SetWithMeta("Jack", []byte("589"), Meta{"etag": "1"})
+
+	if n, ok := gee.SizeOf("Tom"); !ok || n != 6 {
+		t.Fatalf("SizeOf(Tom) = %d, %v, want 6", n, ok)
+	}
+	if n, ok := gee.SizeOf("Jack"); !ok || n != 12 {
+		t.Fatalf("SizeOf(Jack) = %d, %v, want 12", n, ok)
+	}
+	if _, ok := gee.SizeOf("unknown"); ok {
+		t.Fatal("SizeOf(unknown) should be false")
+	}
+	if keys := gee.Keys(); !reflect.DeepEqual(keys, []string{"Jack", "Tom"}) {
+		t.Fatalf("SizeOf should not promote, Keys() = %v", keys)
+	}
+}
+
+func TestAwait(t *testing.T) {
+	gee := NewGroup("await", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return nil, fmt.Errorf("%s not exist", key) }))
+
+	var wg sync.WaitGroup
+	results := make([]string, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := gee.Await(context.Background(), "Tom")
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = v.String()
+		}(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	gee.Set("Tom", []byte("630"))
+	wg.Wait()
+	if !reflect.DeepEqual(results, []string{"630", "630", "630"}) {
+		t.Fatalf("Await results = %v", results)
+	}
+	if v, err := gee.Await(context.Background(), "Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("Await on a cached key = %q, %v", v.String(), err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := gee.Await(ctx, "Jack"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect context.DeadlineExceeded, but %v got", err)
+	}
+	if n := gee.waiters.n.Load(); n != 0 {
+		t.Fatalf("%d waiters left after cancellation", n)
+	}
+}
+
+func TestRecentAccesses(t *testing.T) {
+	gee := NewGroup("accesslog", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }), WithAccessLog(accessLogShards))
+	for i := 0; i < 3*accessLogShards; i++ {
+		gee.Get("k" + strconv.Itoa(i%4))
+	}
+
+	records := gee.RecentAccesses()
+	if len(records) != accessLogShards { // 按序号分片，每个分片保留最近的一条
+		t.Fatalf("got %d records, want %d", len(records), accessLogShards)
+	}
+	for i, r := range records {
+		if i > 0 && r.Seq <= records[i-1].Seq {
+			t.Fatalf("records are not ordered by Seq: %v", records)
+		}
+		if !r.Hit || r.Seq <= 4 { // 只保留了最近的记录，前 4 次未命中已经被覆盖
+			t.Fatalf("unexpected record %+v", r)
+		}
+	}
+	if last := records[len(records)-1]; last.Seq != 3*accessLogShards || last.KeyHash != fnv64a("k3") {
+		t.Fatalf("last record = %+v", last)
+	}
+
+	for i := 0; i < accessLogShards; i++ { // 热点 key 的记录同样分布到所有分片
+		gee.Get("hot")
+	}
+	if records := gee.RecentAccesses(); len(records) != accessLogShards || records[0].KeyHash != fnv64a("hot") {
+		t.Fatalf("expect the hot key to fill every shard, but %+v got", records)
+	}
+
+	if NewGroup("noaccesslog", 2<<10, gee.getter).RecentAccesses() != nil {
+		t.Fatal("RecentAccesses should be nil when the access log is disabled")
+	}
+}
+
+type contentTypeGetter struct{}
+
+func (contentTypeGetter) Get(key string) ([]byte, error) { return []byte(key), nil }
+
+func (contentTypeGetter) GetWithContentType(key string) ([]byte, string, error) {
+	if strings.HasSuffix(key, ".json") {
+		return []byte("{}"), "application/json", nil
+	}
+	return []byte(key), "", nil
+}
+
+func TestContentType(t *testing.T) {
+	gee := NewGroup("contenttype", 2<<10, contentTypeGetter{})
+	if v, _ := gee.Get("a.json"); v.String() != "{}" {
+		t.Fatalf("Get(a.json) = %q, want GetWithContentType to be used", v.String())
+	}
+	gee.Get("a.bin")
+	gee.SetWithMeta("a.txt", []byte("hello"), Meta{MetaContentType: "text/plain"})
+
+	for key, want := range map[string]string{
+		"a.json": "application/json",
+		"a.bin":  DefaultContentType,
+		"a.txt":  "text/plain",
+	} {
+		if ct, ok := gee.ContentType(key); !ok || ct != want {
+			t.Fatalf("ContentType(%s) = %q, %v, want %q", key, ct, ok, want)
+		}
+	}
+	if _, ok := gee.ContentType("unknown"); ok {
+		t.Fatal("ContentType(unknown) should be false")
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	none := NewGroup("samplenone", 2<<10, getter, WithAccessLog(64), WithSampleRate(0))
+	some := NewGroup("samplesome", 2<<10, getter, WithAccessLog(1024), WithSampleRate(0.1))
+	for i := 0; i < 1000; i++ {
+		none.Get("Tom")
+		some.Get(strconv.Itoa(i))
+	}
+	if n := len(none.RecentAccesses()); n != 0 {
+		t.Fatalf("sample rate 0 recorded %d accesses", n)
+	}
+	if n := len(some.RecentAccesses()); n < 30 || n > 300 {
+		t.Fatalf("sample rate 0.1 recorded %d of 1000 accesses", n)
+	}
+}
+
+func TestLoadOrCreateGroup(t *testing.T) {
+	isolateGroups(t)
+	var created atomic.Int32
+	factory := func() Getter {
+		created.Add(1)
+		return GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*Group, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = LoadOrCreateGroup("loadorcreate", 2<<10, factory)
+		}(i)
+	}
+	wg.Wait()
+	if n := created.Load(); n != 1 {
+		t.Fatalf("getter factory called %d times, want 1", n)
+	}
+	for _, g := range results {
+		if g != results[0] || g != GetGroup("loadorcreate") {
+			t.Fatal("LoadOrCreateGroup should return the same group")
+		}
+	}
+}
+
+// isolateGroups 让测试从空的全局 group 表和条目总数开始，结束时恢复，使依赖全局状态的测试可以重复运行
+func isolateGroups(t *testing.T) {
+	t.Helper()
+	mu.Lock()
+	saved, savedMax := groups, maxGroups
+	groups = make(map[string]*Group)
+	mu.Unlock()
+	savedTotal := totalEntries.Swap(0)
+	lastVictim.Store(nil)
+	t.Cleanup(func() {
+		mu.Lock()
+		groups, maxGroups = saved, savedMax
+		mu.Unlock()
+		totalEntries.Store(savedTotal)
+		lastVictim.Store(nil)
+	})
+}
+
+func TestGlobalMaxEntries(t *testing.T) {
+	isolateGroups(t)
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	big := NewGroup("globalbig", UnlimitedBytes, getter)
+	small := NewGroup("globalsmall", 2<<10, getter)
+	for i := 0; i < 10; i++ {
+		big.Set("k"+strconv.Itoa(i), []byte("v"))
+	}
+	small.Set("k0", []byte("v"))
+
+	SetGlobalMaxEntries(totalEntries.Load())
+	defer SetGlobalMaxEntries(0)
+	small.Set("k1", []byte("v"))
+	if big.Len() != 9 || small.Len() != 2 {
+		t.Fatalf("big.Len() = %d, small.Len() = %d, want 9 and 2", big.Len(), small.Len())
+	}
+	if _, ok := big.GetStale("k0"); ok {
+		t.Fatal("the oldest entry of the largest group should be evicted")
+	}
+}
+
+func TestGlobalVictim(t *testing.T) {
+	isolateGroups(t)
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	hot := NewGroup("globalhot", UnlimitedBytes, getter)
+	cold := NewGroup("globalcold", UnlimitedBytes, getter)
+	for i := 0; i < 10; i++ {
+		hot.Set("k"+strconv.Itoa(i), []byte("v"))
+		hot.Get("k" + strconv.Itoa(i))
+	}
+	cold.Set("k0", []byte("v"))
+	cold.Set("k1", []byte("v"))
+	cold.GetCacheOnly("missing")
+
+	SetGlobalVictim(VictimLowestHitRate)
+	defer SetGlobalVictim(VictimMostEntries)
+	SetGlobalMaxEntries(totalEntries.Load())
+	defer SetGlobalMaxEntries(0)
+	hot.Set("k10", []byte("v"))
+	if hot.Len() != 11 || cold.Len() != 1 {
+		t.Fatalf("hot.Len() = %d, cold.Len() = %d, want 11 and 1", hot.Len(), cold.Len())
+	}
+
+	// 选出的 group 被复用，不需要重新扫描，即使它已经不是命中率最低的
+	for i := 0; i < 20; i++ {
+		cold.Get("k1")
+	}
+	hot.Set("k11", []byte("v"))
+	if hot.Len() != 12 || cold.Len() != 0 {
+		t.Fatalf("hot.Len() = %d, cold.Len() = %d, want 12 and 0", hot.Len(), cold.Len())
+	}
+
+	// 复用的 group 无法淘汰时重新扫描
+	hot.Set("k12", []byte("v"))
+	if hot.Len() != 12 {
+		t.Fatalf("hot.Len() = %d, want 12", hot.Len())
+	}
+}
+
+func TestGlobalMaxEntriesSkipsCopyOnWrite(t *testing.T) {
+	isolateGroups(t)
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	static := NewGroup("globalcow", 0, getter, WithCopyOnWrite())
+	for i := 0; i < 50; i++ {
+		static.Set("k"+strconv.Itoa(i), []byte("v"))
+	}
+
+	SetGlobalMaxEntries(10)
+	defer SetGlobalMaxEntries(0)
+	lru := NewGroup("globallru", UnlimitedBytes, getter)
+	for i := 0; i < 20; i++ {
+		lru.Set("k"+strconv.Itoa(i), []byte("v"))
+	}
+	if lru.Len() != 10 || static.Len() != 50 {
+		t.Fatalf("lru.Len() = %d, static.Len() = %d, want 10 and 50", lru.Len(), static.Len())
+	}
+
+	// 被同名的 group 替换之后，旧 group 的条目不再计入总数
+	replaced := NewGroup("globallru", UnlimitedBytes, getter)
+	if n := totalEntries.Load(); n != 0 {
+		t.Fatalf("totalEntries = %d after replacing the group, want 0", n)
+	}
+	lru.Set("k100", []byte("v"))
+	if n := totalEntries.Load(); n != 0 {
+		t.Fatalf("totalEntries = %d after writing to the replaced group, want 0", n)
+	}
+	for i := 0; i < 10; i++ {
+		replaced.Set("k"+strconv.Itoa(i), []byte("v"))
+	}
+	if replaced.Len() != 10 {
+		t.Fatalf("replaced.Len() = %d, want 10", replaced.Len())
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	gee := NewGroup("prefetch", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads.Add(1)
+			<-release
+			return []byte(key), nil
+		}))
+
+	gee.Prefetch("Tom")
+	gee.Prefetch("Tom")
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("Get(Tom) = %q, %v", v.String(), err)
+	}
+	gee.Prefetch("Tom") // 已经在缓存中
+	if err := gee.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("getter called %d times, want 1", n)
+	}
+}
+
+func TestSnapshotToRestoreFrom(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	src := NewGroup("snapshotto", 2<<10, getter)
+	src.Set("Tom", []byte("630"))
+	src.Set("Jack", []byte("589"))
+	src.Set("Sam", []byte("567"))
+	src.Get("Tom")
+
+	for _, codec := range []SnapshotCodec{nil, GzipSnapshotCodec{}} {
+		var buf bytes.Buffer
+		if err := src.SnapshotTo(&buf, codec); err != nil {
+			t.Fatal(err)
+		}
+		dst := NewGroup("restorefrom", 2<<10, getter)
+		if n, err := dst.RestoreFrom(&buf, codec); err != nil || n != 3 {
+			t.Fatalf("RestoreFrom(%T) = %d, %v", codec, n, err)
+		}
+		if !reflect.DeepEqual(dst.Snapshot(), src.Snapshot()) {
+			t.Fatalf("restored %v, want %v", dst.Snapshot(), src.Snapshot())
+		}
+	}
+
+	// 格式不匹配或者内容被截断时返回错误，不写入任何条目
+	var gz bytes.Buffer
+	_ = src.SnapshotTo(&gz, GzipSnapshotCodec{})
+	var bin bytes.Buffer
+	_ = src.SnapshotTo(&bin, nil)
+	dst := NewGroup("restoremismatch", 2<<10, getter)
+	if _, err := dst.RestoreFrom(bytes.NewReader(gz.Bytes()), nil); !errors.Is(err, ErrSnapshotFormat) {
+		t.Fatalf("expect ErrSnapshotFormat for gzip read as binary, but %v got", err)
+	}
+	if _, err := dst.RestoreFrom(bytes.NewReader(bin.Bytes()), GzipSnapshotCodec{}); !errors.Is(err, ErrSnapshotFormat) {
+		t.Fatalf("expect ErrSnapshotFormat for binary read as gzip, but %v got", err)
+	}
+	if _, err := dst.RestoreFrom(bytes.NewReader(bin.Bytes()[:bin.Len()-1]), nil); !errors.Is(err, ErrSnapshotFormat) {
+		t.Fatalf("expect ErrSnapshotFormat for truncated snapshot, but %v got", err)
+	}
+	if dst.Len() != 0 {
+		t.Fatalf("failed restores should not populate the cache, len = %d", dst.Len())
+	}
+}
+
+func TestReplaceAll(t *testing.T) {
+	var evicted []string
+	gee := NewGroup("replaceall", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }),
+		WithOnEvicted(func(key string, value ByteView) { evicted = append(evicted, key) }))
+	gee.Set("Tom", []byte("630"))
+	gee.Set("Jack", []byte("589"))
+
+	gee.ReplaceAll(map[string][]byte{"Tom": []byte("631"), "Sam": []byte("567")})
+	if !reflect.DeepEqual(evicted, []string{"Jack"}) {
+		t.Fatalf("evicted = %v, want [Jack]", evicted)
+	}
+	want := map[string]string{"Tom": "631", "Sam": "567"}
+	got := make(map[string]string)
+	for _, kv := range gee.Snapshot() {
+		got[kv.Key] = kv.Value.String()
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("after ReplaceAll got %v, want %v", got, want)
+	}
+}
+
+func TestCommitRefresh(t *testing.T) {
+	var evicted []string
+	gee := NewGroup("commitrefresh", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return nil, errors.New("no getter") }),
+		WithOnEvicted(func(key string, value ByteView) { evicted = append(evicted, key) }))
+	gee.Set("Tom", []byte("630"))
+	gee.Set("Jack", []byte("589"))
+	_, oldVersion, _ := gee.GetWithVersion("Tom")
+
+	standby := gee.BeginRefresh()
+	standby.Set("Tom", []byte("631"))
+	standby.Set("Sam", []byte("567"))
+	if v, err := gee.GetCacheOnly("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("before commit Get(Tom) = %q, %v, want 630", v.String(), err)
+	}
+	if _, err := gee.GetCacheOnly("Sam"); err == nil {
+		t.Fatal("standby entry visible before commit")
+	}
+
+	if err := gee.CommitRefresh(standby); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(evicted, []string{"Jack", "Tom"}) { // 最久未使用的在前，Tom 刚被读取过
+		t.Fatalf("evicted = %v, want [Jack Tom]", evicted)
+	}
+	if keys := gee.Keys(); !reflect.DeepEqual(keys, []string{"Sam", "Tom"}) {
+		t.Fatalf("Keys() = %v, want [Sam Tom]", keys)
+	}
+	if n := gee.Len(); n != 2 {
+		t.Fatalf("Len() = %d, want 2", n)
+	}
+	v, version, _ := gee.GetWithVersion("Tom")
+	if v.String() != "631" || version <= oldVersion {
+		t.Fatalf("after commit Tom = %q version %d, want 631 with a version after %d", v.String(), version, oldVersion)
+	}
+	if _, ok := gee.CompareAndSwap("Tom", oldVersion, []byte("x")); ok {
+		t.Fatal("CompareAndSwap succeeded with a version from before the refresh")
+	}
+	if err := gee.CommitRefresh(standby); !errors.Is(err, ErrInvalidStandby) {
+		t.Fatalf("second commit err = %v, want ErrInvalidStandby", err)
+	}
+}
+
+func TestCopyOnWrite(t *testing.T) {
+	var evicted []string
+	loads := 0
+	gee := NewGroup("copyonwrite", 1, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("value of " + key), nil
+		}), WithCopyOnWrite(),
+		WithOnEvicted(func(key string, value ByteView) { evicted = append(evicted, key) }))
+
+	for i := 0; i < 2; i++ {
+		if v, err := gee.Get("Tom"); err != nil || v.String() != "value of Tom" {
+			t.Fatalf("Get(Tom) = %q, %v", v.String(), err)
+		}
+	}
+	gee.Set("Jack", []byte("589")) // 不按容量淘汰
+	gee.Set("Sam", []byte("567"))
+	if loads != 1 {
+		t.Fatalf("getter called %d times, want 1", loads)
+	}
+	if keys := gee.Keys(); !reflect.DeepEqual(keys, []string{"Jack", "Sam", "Tom"}) {
+		t.Fatalf("Keys() = %v, want [Jack Sam Tom]", keys)
+	}
+	gee.Set("counter", []byte("1"))
+	if n, err := gee.AddInt("counter", 2); err != nil || n != 3 {
+		t.Fatalf("AddInt = %d, %v", n, err)
+	}
+
+	gee.ReplaceAll(map[string][]byte{"Tom": []byte("631")})
+	sort.Strings(evicted)
+	if !reflect.DeepEqual(evicted, []string{"Jack", "Sam", "counter"}) {
+		t.Fatalf("evicted = %v, want [Jack Sam counter]", evicted)
+	}
+	if kvs := gee.Snapshot(); len(kvs) != 1 || kvs[0].Key != "Tom" || kvs[0].Value.String() != "631" {
+		t.Fatalf("Snapshot() = %v, want only Tom=631", kvs)
+	}
+	if n := gee.DeletePrefix("T"); n != 1 || gee.Len() != 0 {
+		t.Fatalf("DeletePrefix(T) = %d, Len() = %d", n, gee.Len())
+	}
+}
+
+func BenchmarkCopyOnWriteGet(b *testing.B) {
+	gee := NewGroup("copyonwritebench", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }), WithCopyOnWrite())
+	_, _ = gee.Get("config")
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = gee.Get("config")
+		}
+	})
+}
+
+func TestPop(t *testing.T) {
+	var evicted []string
+	gee := NewGroup("pop", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }),
+		WithOnEvicted(func(key string, value ByteView) { evicted = append(evicted, key+"="+value.String()) }))
+	gee.Set("Tom", []byte("630"))
+	gee.Set("Jack", []byte("589"))
+
+	if v, ok := gee.Pop("Tom"); !ok || v.String() != "630" {
+		t.Fatalf("Pop(Tom) = %q, %v, want 630", v.String(), ok)
+	}
+	if _, ok := gee.Pop("Tom"); ok {
+		t.Fatal("second Pop(Tom) should miss")
+	}
+	if _, ok := gee.Pop("Sam"); ok {
+		t.Fatal("Pop should not load a missing key")
+	}
+	if !reflect.DeepEqual(evicted, []string{"Tom=630"}) {
+		t.Fatalf("evicted = %v, want [Tom=630]", evicted)
+	}
+	if keys := gee.Keys(); !reflect.DeepEqual(keys, []string{"Jack"}) {
+		t.Fatalf("Keys() = %v, want [Jack]", keys)
+	}
+	if n, _ := gee.SizeOf("Jack"); gee.EstimatedHeapBytes() != uint64(n)+entryOverhead {
+		t.Fatal("byte accounting should only include Jack after Pop")
+	}
+}
+
+func TestEstimatedHeapBytes(t *testing.T) {
+	gee := NewGroup("heapbytes", UnlimitedBytes, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	if n := gee.EstimatedHeapBytes(); n != 0 {
+		t.Fatalf("EstimatedHeapBytes() = %d on an empty group, want 0", n)
+	}
+
+	var accounted int64
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		gee.Set(key, []byte("value of "+key))
+		n, _ := gee.SizeOf(key)
+		accounted += n
+	}
+	if n := gee.EstimatedHeapBytes(); n != uint64(accounted)+3*entryOverhead {
+		t.Fatalf("EstimatedHeapBytes() = %d, want %d plus 3 entries of overhead", n, accounted)
+	}
+}
+
+func TestGetUnsafe(t *testing.T) {
+	gee := NewGroup("getunsafe", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("630"), nil }))
+	b, err := gee.GetUnsafe("Tom")
+	if err != nil || string(b) != "630" {
+		t.Fatalf("GetUnsafe(Tom) = %q, %v", b, err)
+	}
+	v, _ := gee.GetStale("Tom")
+	if &b[0] != &v.b[0] {
+		t.Fatal("GetUnsafe should return the cached slice without copying")
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	gee := NewGroup("getversion", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }), WithVersionHistory(2))
+
+	before := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	gee.Set("Tom", []byte("1"))
+	time.Sleep(2 * time.Millisecond)
+	t1 := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	gee.Set("Tom", []byte("22"))
+	time.Sleep(2 * time.Millisecond)
+	t2 := time.Now()
+
+	if v, ok := gee.GetVersion("Tom", t2); !ok || v.String() != "22" {
+		t.Fatalf("GetVersion(Tom, t2) = %q, %v, want 22", v.String(), ok)
+	}
+	if v, ok := gee.GetVersion("Tom", t1); !ok || v.String() != "1" {
+		t.Fatalf("GetVersion(Tom, t1) = %q, %v, want 1", v.String(), ok)
+	}
+	if _, ok := gee.GetVersion("Tom", before); ok {
+		t.Fatal("GetVersion before the first write should miss")
+	}
+	if n, _ := gee.SizeOf("Tom"); n != 3+1+2 { // 旧版本计入容量
+		t.Fatalf("SizeOf(Tom) = %d, want 6", n)
+	}
+
+	gee.Set("Tom", []byte("333")) // 只保留 2 个版本
+	if _, ok := gee.GetVersion("Tom", t1); ok {
+		t.Fatal("the oldest version should be dropped")
+	}
+	if n, _ := gee.SizeOf("Tom"); n != 3+2+3 {
+		t.Fatalf("SizeOf(Tom) = %d, want 8", n)
+	}
+
+	plain := NewGroup("getversionplain", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	plain.Set("Tom", []byte("v"))
+	if _, ok := plain.GetVersion("Tom", time.Now()); ok { // 没有记录写入时间
+		t.Fatal("GetVersion without WithVersionHistory should miss")
+	}
+}
+
+// policies 是用于对比的淘汰策略
+var policies = []struct {
+	name      string
+	newPolicy func(maxBytes int64, onEvicted func(string, lru.Value)) Policy
+}{
+	{"lru", nil},
+	{"lru-2", func(maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+		return lruk.New(2, maxBytes, onEvicted)
+	}},
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	var evicted []string
+	gee := NewGroup("evictionpolicy", 6, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("v"), nil }),
+		WithEvictionPolicy(policies[1].newPolicy),
+		WithOnEvicted(func(key string, value ByteView) { evicted = append(evicted, key) }))
+	gee.Get("h")
+	gee.Get("h") // h 被访问了两次，扫描的 key 不会把它挤出去
+	for _, key := range []string{"a", "b", "c", "d"} {
+		gee.Get(key)
+	}
+	if !reflect.DeepEqual(evicted, []string{"a", "b"}) {
+		t.Fatalf("evicted = %v, want [a b]", evicted)
+	}
+	if _, ok := gee.GetStale("h"); !ok || gee.Len() != 3 {
+		t.Fatalf("h should survive the scan, Len() = %d", gee.Len())
+	}
+}
+
+// BenchmarkEvictionPolicyHitRate 录制一段热点 key 与扫描混合的访问，在每种淘汰策略上回放并报告命中率
+func BenchmarkEvictionPolicyHitRate(b *testing.B) {
+	var accesses bytes.Buffer
+	recording := NewGroup("policyrecording", UnlimitedBytes, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("v"), nil }))
+	recording.StartRecording(&accesses)
+	for i := 0; i < 20000; i++ {
+		recording.Get("hot" + strconv.Itoa(i*7%64))
+		if i%4 == 0 {
+			recording.Get("scan" + strconv.Itoa(i))
+		}
+	}
+	if err := recording.StopRecording(); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, p := range policies {
+		b.Run(p.name, func(b *testing.B) {
+			var loads, gets int
+			for i := 0; i < b.N; i++ {
+				var misses atomic.Int64
+				g := NewGroup("policyreplay", 64*8, GetterFunc(
+					func(key string) ([]byte, error) {
+						misses.Add(1)
+						return []byte("v"), nil
+					}), WithEvictionPolicy(p.newPolicy))
+				if err := ReplayFrom(bytes.NewReader(accesses.Bytes()), g); err != nil {
+					b.Fatal(err)
+				}
+				loads += int(misses.Load())
+				gets += 25000
+			}
+			b.ReportMetric(100*(1-float64(loads)/float64(gets)), "hit%")
+		})
+	}
+}
+
+func TestCloseOrdering(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	logEvent := func(e string) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+	release := make(chan struct{})
+	gee := NewGroup("closeordering", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			<-release
+			logEvent("load " + key)
+			return []byte(key), nil
+		}), WithWriteBack(WriterFunc(func(key string, value []byte) error {
+		logEvent("write " + key)
+		return nil
+	})))
+	gee.SetDirty("dirty", []byte("v"))
+	gee.Prefetch("Tom")
+	time.Sleep(10 * time.Millisecond)
+
+	closed := make(chan error)
+	go func() { closed <- gee.Close() }()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := gee.Get("Jack"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expect ErrClosed while closing, but %v got", err)
+	}
+	close(release)
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	// 进行中的加载先结束，之后才写入脏条目
+	if want := []string{"load Tom", "write dirty"}; !reflect.DeepEqual(events, want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+}
+
+func TestCloseTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	gee := NewGroup("closetimeout", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			<-release
+			return []byte(key), nil
+		}), WithCloseTimeout(10*time.Millisecond))
+	gee.Prefetch("Tom")
+	time.Sleep(5 * time.Millisecond)
+	if err := gee.Close(); !errors.Is(err, ErrCloseTimeout) {
+		t.Fatalf("expect ErrCloseTimeout, but %v got", err)
+	}
+	if err := gee.Close(); !errors.Is(err, ErrCloseTimeout) {
+		t.Fatalf("repeated Close should return the first result, but %v got", err)
+	}
+}
@@ -0,0 +1,123 @@
+package gee_cache
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// 所有 group 的条目总数上限
+
+var (
+	totalEntries     atomic.Int64 // 所有 group 当前缓存的条目总数
+	globalMaxEntries atomic.Int64 // 条目总数的上限，为 0 时不限制
+	globalVictim     atomic.Int32 // 选择淘汰哪个 group 的策略，见 GlobalVictim
+
+	// 上一次扫描选出的 group 在 victimReuse 次淘汰之内复用，达到上限之后的写入不必每次都扫描所有 group
+	lastVictim   atomic.Pointer[cache]
+	victimBudget atomic.Int64 // lastVictim 还可以复用的淘汰次数
+)
+
+// victimReuse 是扫描选出的 group 最多连续被淘汰的次数，之后重新扫描
+const victimReuse = 64
+
+// GlobalVictim 决定条目总数超过 SetGlobalMaxEntries 设置的上限时从哪个 group 中淘汰
+type GlobalVictim int32
+
+const (
+	VictimMostEntries   GlobalVictim = iota // 条目最多的 group，这是默认值
+	VictimLowestHitRate                     // Get 命中率最低的 group，从未被查找过的 group 命中率视为 0
+)
+
+// SetGlobalMaxEntries 设置整个进程中所有 group 缓存的条目总数上限，用于限制字典和 GC 的整体开销。
+// 写入之后总数超过 n 时，从 SetGlobalVictim 选出的 group 中淘汰最久未使用的条目，直到不超过 n，被淘汰的条目与容量不足时一样触发回调。
+// 这是在每个 group 自己的容量之上的一个粗略的保护：选出的 group 会被连续淘汰若干次之后才重新比较所有 group。
+// n 为 0 时不限制，这也是默认值。
+func SetGlobalMaxEntries(n int64) {
+	globalMaxEntries.Store(n)
+}
+
+// SetGlobalVictim 设置超过条目总数上限时选择淘汰哪个 group，默认为 VictimMostEntries
+func SetGlobalVictim(v GlobalVictim) {
+	globalVictim.Store(int32(v))
+	lastVictim.Store(nil)
+}
+
+// enforceGlobalMaxEntries 在条目总数超过上限时淘汰条目，调用方不能持有任何 cache 的锁或者 mu
+// 优先复用上一次选出的 group，它用完了复用次数或者无法淘汰时才扫描所有 group，
+// 扫描时按 SetGlobalVictim 的策略依次尝试，直到有一个 group 淘汰了条目（例如所有条目都被固定时无法淘汰）
+func enforceGlobalMaxEntries() {
+	limit := globalMaxEntries.Load()
+	for limit > 0 && totalEntries.Load() > limit {
+		if v := lastVictim.Load(); v != nil && victimBudget.Add(-1) >= 0 && v.removeOldest() {
+			continue
+		}
+		removed := false
+		for _, victim := range victimCandidates(GlobalVictim(globalVictim.Load())) {
+			if victim.removeOldest() {
+				lastVictim.Store(victim)
+				victimBudget.Store(victimReuse - 1)
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			lastVictim.Store(nil)
+			return
+		}
+	}
+}
+
+// victimCandidates 返回所有计入条目总数并且有条目的 group 的 cache，按策略 v 排序，最先淘汰的在前。
+// 写时复制的缓存不计入条目总数，也不能按最久未使用淘汰，因此不在其中
+func victimCandidates(v GlobalVictim) []*cache {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	type candidate struct {
+		c       *cache
+		n       int
+		hitRate float64
+	}
+	var candidates []candidate
+	for _, g := range groups {
+		c := &g.mainCache
+		if c.cow != nil {
+			continue
+		}
+		c.lock()
+		n, hits, lookups := c.entries, c.stats.hits, c.stats.hits+c.stats.misses
+		c.unlock()
+		if n == 0 {
+			continue
+		}
+		cand := candidate{c: c, n: n}
+		if lookups > 0 {
+			cand.hitRate = float64(hits) / float64(lookups)
+		}
+		candidates = append(candidates, cand)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if v == VictimLowestHitRate && a.hitRate != b.hitRate {
+			return a.hitRate < b.hitRate
+		}
+		return a.n > b.n
+	})
+	caches := make([]*cache, len(candidates))
+	for i, cand := range candidates {
+		caches[i] = cand.c
+	}
+	return caches
+}
+
+// untrack 在 group 被同名的新 group 替换时调用，从条目总数中减去 c 当前的条目，之后 c 的变化不再计入
+func (c *cache) untrack() {
+	c.lock()
+	defer c.unlock()
+
+	if !c.untracked {
+		c.untracked = true
+		totalEntries.Add(-int64(c.entries))
+	}
+	lastVictim.CompareAndSwap(c, nil) // 不再持有被替换的 group
+}
@@ -0,0 +1,55 @@
+package gee_cache
+
+import "time"
+
+// 后台定期清理过期的条目
+
+// janitorChunkSize 是清理时每次持有锁检查的条目数
+const janitorChunkSize = 256
+
+// StartJanitor 启动一个后台 goroutine，每隔 interval 清理一次已经过期的条目，Close 时退出。
+// 清理是分块进行的，每次持有锁只检查 janitorChunkSize 个条目，与条目总数无关，避免长时间阻塞正常的访问。
+// concurrency 留给分片的 cache 同时清理不同的分片使用；当前的 cache 没有分片，所有块共享同一把锁，清理总是串行进行。
+// 只有条目会过期（WithTTL、WithMaxAge 或者 TTLGetter）时才需要启动，重复调用不会启动多个 goroutine。
+func (g *Group) StartJanitor(interval time.Duration, concurrency int) {
+	if interval <= 0 || !g.janitorStarted.CompareAndSwap(false, true) {
+		return
+	}
+
+	g.janitorWG.Add(1)
+	go func() {
+		defer g.janitorWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-g.stopJanitor:
+				return
+			case <-ticker.C:
+				g.mainCache.removeExpired()
+			}
+		}
+	}()
+}
+
+// removeExpired 分块删除所有已经过期的条目，每块单独加锁
+// 除了 WithTTL 之外，WithMaxAge 和 TTLGetter 也会让条目过期，因此没有设置 TTL 时也需要检查
+func (c *cache) removeExpired() {
+	if c.cow != nil { // 写时复制的缓存中的条目不会过期
+		return
+	}
+	var w chunkWalk
+	for more := true; more; {
+		now := time.Now()
+		c.lock()
+		more = c.nextChunk(&w, janitorChunkSize, func(stored string, it *item) {
+			if it.expired(now) {
+				c.lru.Remove(stored)
+			}
+		})
+		evicted := c.takeEvicted(InvalidationExpired)
+		c.unlock()
+
+		c.notifyEvicted(evicted)
+	}
+}
@@ -1,28 +1,78 @@
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"sort"
+)
 
 // Cache 是一个LRU 缓存。并发不安全。
+// 未开启 EvictCandidates 且没有固定记录时，淘汰顺序是确定的：严格按照最近一次 Add 或 Get 的先后顺序，最久未使用的最先淘汰，
+// Remove 不影响其余记录的顺序。
 type Cache struct {
 	maxBytes int64                    // 允许使用的最大内存
 	nbytes   int64                    // 当前已使用的内存
 	ll       *list.List               // 双向链表
 	cache    map[string]*list.Element // 键是字符串，值是双向链表中对应节点的指针
 	// 可选，在某条记录被移除时的回调函数
+	// 回调在该记录的链表、字典和 nbytes 都更新完成之后才调用，因此可以在回调中重入 Add、Remove 等方法。
 	OnEvicted func(key string, value Value)
+	// 可选，所有未固定的记录都已淘汰但仍然超过 maxBytes 时的回调函数。
+	// 固定的记录永远不会被淘汰，此时缓存会超出预算继续工作。
+	OnOverBudget func(nbytes, maxBytes int64)
+	// 可选，大于 1 时开启按大小淘汰：从最久未使用的 EvictCandidates 个记录中淘汰字节数最大的一个，
+	// 而不是严格淘汰最久未使用的记录。最多检查 MaxEvictCandidates 个记录。
+	EvictCandidates int
+
+	order   writeOrder // 按写入的先后顺序串起所有记录，供 NewCursor 分批遍历
+	cursors []*cursor  // 尚未结束的 Cursor，删除记录时需要更新它们的位置
 }
 
+// MaxEvictCandidates 是按大小淘汰时最多检查的记录数，保证选择的开销是常数
+const MaxEvictCandidates = 16
+
 // entry 是双向链表节点的数据类型，在链表中仍保存每个值对应的 key 的好处在于，淘汰队首节点时，需要用 key 从字典中删除对应的映射。
+// size 是插入时计算的字节数，移除时直接使用，保证扣除的字节数与加入时一致。
 type entry struct {
-	key   string
-	value Value
+	key    string
+	value  Value
+	size   int64 // int64(len(key)) + int64(value.Len())
+	pinned bool  // 固定的记录不会被 RemoveOldest 淘汰
+
+	older, newer *entry // 在 writeOrder 中的前后记录，更新值时不变
+}
+
+// EvictionPolicy 是各种淘汰策略共同的接口，Cache 和 lruk.Cache 都实现了它，可以在同一套代码中互相替换和对比
+type EvictionPolicy interface {
+	Get(key string) (value Value, ok bool)
+	Add(key string, value Value)
+	Remove(key string) bool
+	Len() int
+	Bytes() int64 // 当前已使用的字节数
 }
 
+var _ EvictionPolicy = (*Cache)(nil)
+
 // Value 使用 Len 来返回其在内存中的大小
 type Value interface {
 	Len() int
 }
 
+// StringValue 是实现了 Value 接口的字符串，方便直接缓存字符串
+type StringValue string
+
+// Len 返回字符串的字节数
+func (s StringValue) Len() int {
+	return len(s)
+}
+
+// BytesValue 是实现了 Value 接口的字节切片，方便直接缓存字节切片
+type BytesValue []byte
+
+// Len 返回字节切片的长度
+func (b BytesValue) Len() int {
+	return len(b)
+}
+
 // New 创建一个新的 Cache
 func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
 	return &Cache{
@@ -33,6 +83,16 @@ func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
 	}
 }
 
+// NewWithCapacity 与 New 相同，但预先为 expectedEntries 个条目分配字典空间，避免预热时反复扩容
+func NewWithCapacity(maxBytes int64, expectedEntries int, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		ll:        list.New(),
+		cache:     make(map[string]*list.Element, expectedEntries),
+		OnEvicted: onEvicted,
+	}
+}
+
 // Get 查找一个 key
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.cache[key]; ok {
@@ -43,42 +103,195 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 	return
 }
 
-// RemoveOldest 移除最久未使用的记录
+// Peek 查找一个 key，但不会将其移到队尾，不影响淘汰顺序
+func (c *Cache) Peek(key string) (value Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// SizeOf 返回 key 计入 nbytes 的字节数，即插入时计算的 len(key) + value.Len()，不影响淘汰顺序
+func (c *Cache) SizeOf(key string) (int64, bool) {
+	if ele, ok := c.cache[key]; ok {
+		return ele.Value.(*entry).size, true
+	}
+	return 0, false
+}
+
+// RemoveOldest 移除最久未使用的记录，跳过固定的记录
 func (c *Cache) RemoveOldest() {
-	ele := c.ll.Back() // 取到队首节点，从链表中删除。
-	if ele != nil {
-		c.ll.Remove(ele)
+	c.removeOldest()
+}
+
+// removeOldest 移除最久未使用的未固定记录，返回是否移除了记录
+// 开启按大小淘汰时，从最久未使用的 EvictCandidates 个未固定记录中移除字节数最大的一个
+func (c *Cache) removeOldest() bool {
+	candidates := min(max(c.EvictCandidates, 1), MaxEvictCandidates)
+	var victim *list.Element
+	for ele := c.ll.Back(); ele != nil && candidates > 0; ele = ele.Prev() { // 从队首开始，跳过固定的节点
+		kv := ele.Value.(*entry)
+		if kv.pinned {
+			continue
+		}
+		if victim == nil || kv.size > victim.Value.(*entry).size {
+			victim = ele
+		}
+		candidates--
+	}
+	if victim == nil {
+		return false
+	}
+	c.removeElement(victim)
+	return true
+}
+
+// EvictBy 按 score 从低到高移除记录，直到已使用的内存不超过 targetBytes，跳过固定的记录，返回移除的记录数。
+// score 相同时先移除较久未使用的记录。每条被移除的记录都会调用 OnEvicted。
+// 它适合在内存压力等信号出现时由调用方主动触发，需要对所有记录打分并排序，开销为 O(n log n)。
+func (c *Cache) EvictBy(score func(key string, value Value) int64, targetBytes int64) int {
+	if c.nbytes <= targetBytes {
+		return 0
+	}
+	type candidate struct {
+		ele   *list.Element
+		score int64
+	}
+	candidates := make([]candidate, 0, c.ll.Len())
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
 		kv := ele.Value.(*entry)
-		// 从字典中 c.cache 删除该节点的映射关系。
-		delete(c.cache, kv.key)
-		// 更新当前所用的内存 c.nbytes。
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-
-		// 如果回调函数 OnEvicted 不为 nil，则调用回调函数。
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+		if !kv.pinned {
+			candidates = append(candidates, candidate{ele, score(kv.key, kv.value)})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score < candidates[j].score })
+
+	n := 0
+	for _, cand := range candidates {
+		if c.nbytes <= targetBytes {
+			break
 		}
+		kv := cand.ele.Value.(*entry)
+		if c.cache[kv.key] != cand.ele { // 已经在之前的 OnEvicted 回调中被移除或替换
+			continue
+		}
+		c.removeElement(cand.ele)
+		n++
+	}
+	return n
+}
+
+// Pin 固定一个已存在的 key，固定的记录不会因为容量不足被淘汰，但仍可以被 Remove 移除
+func (c *Cache) Pin(key string) {
+	if ele, ok := c.cache[key]; ok {
+		ele.Value.(*entry).pinned = true
+	}
+}
+
+// Unpin 取消固定一个 key
+func (c *Cache) Unpin(key string) {
+	if ele, ok := c.cache[key]; ok {
+		ele.Value.(*entry).pinned = false
+	}
+}
+
+// Remove 移除指定的 key，返回 key 是否存在
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// RemoveAndGet 移除指定的 key 并返回它的值，key 不存在时返回 false。与 Remove 一样会调用 OnEvicted
+func (c *Cache) RemoveAndGet(key string) (value Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		value = ele.Value.(*entry).value
+		c.removeElement(ele)
+		return value, true
+	}
+	return nil, false
+}
+
+// removeElement 从链表和字典中删除节点，并调用回调函数
+func (c *Cache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	c.unlink(kv)
+	// 从字典中 c.cache 删除该节点的映射关系。
+	delete(c.cache, kv.key)
+	// 更新当前所用的内存 c.nbytes。
+	c.nbytes -= kv.size
+
+	// 如果回调函数 OnEvicted 不为 nil，则调用回调函数。
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
 	}
 }
 
 // Add 向缓存添加一个值
 func (c *Cache) Add(key string, value Value) {
+	c.insert(key, value)
+	c.evict()
+}
+
+// Swap 与 Add 相同，但是在 key 已存在时返回被替换的旧值
+func (c *Cache) Swap(key string, value Value) (old Value, existed bool) {
+	old, existed = c.insert(key, value)
+	c.evict()
+	return
+}
+
+// Entry 是批量添加时的一条记录
+type Entry struct {
+	Key   string
+	Value Value
+}
+
+// AddAll 批量添加多个值，全部插入之后只执行一次淘汰检查。
+// key 各不相同且未开启 EvictCandidates 时，最终结果与依次调用 Add 相同：驻留的条目相同，并且不超过 maxBytes。
+// 同一个 key 出现多次时以最后一个值为准，前面的值不会引起淘汰，因此可能比依次调用 Add 保留更多的条目。
+func (c *Cache) AddAll(entries []Entry) {
+	for _, e := range entries {
+		c.insert(e.Key, e.Value)
+	}
+	c.evict()
+}
+
+// insert 插入或更新一个值，不做淘汰检查，key 已存在时返回被替换的旧值
+func (c *Cache) insert(key string, value Value) (old Value, existed bool) {
 	if ele, ok := c.cache[key]; ok { // 如果键存在，则更新对应节点的值，并将该节点移到队尾。
 		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
 		// 更新值
-		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		size := int64(len(key)) + int64(value.Len())
+		c.nbytes += size - kv.size
+		old = kv.value
 		kv.value = value
-	} else { // 不存在则是新增场景，首先队尾添加新节点 &entry{key, value}, 并字典中添加 key 和节点的映射关系。
-		// 添加新元素
-		ele = c.ll.PushFront(&entry{key, value})
-		c.cache[key] = ele
-		c.nbytes += int64(len(key)) + int64(value.Len())
+		kv.size = size
+		return old, true
 	}
+	// 不存在则是新增场景，首先队尾添加新节点 &entry{key, value, size}, 并字典中添加 key 和节点的映射关系。
+	size := int64(len(key)) + int64(value.Len())
+	kv := &entry{key: key, value: value, size: size}
+	c.order.push(kv)
+	ele := c.ll.PushFront(kv)
+	c.cache[key] = ele
+	c.nbytes += size
+	return nil, false
+}
 
-	// 更新 c.nbytes，如果超过了设定的最大值 c.maxBytes，则移除最少访问的节点。
+// evict 如果 c.nbytes 超过了设定的最大值 c.maxBytes，则移除最少访问的节点。
+// 如果剩下的都是固定的节点，则保留它们并超出预算，调用 OnOverBudget 告警。
+func (c *Cache) evict() {
 	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
-		c.RemoveOldest()
+		if !c.removeOldest() {
+			if c.OnOverBudget != nil {
+				c.OnOverBudget(c.nbytes, c.maxBytes)
+			}
+			return
+		}
 	}
 }
 
@@ -86,3 +299,112 @@ func (c *Cache) Add(key string, value Value) {
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// Bytes 返回当前已使用的字节数，包括 key 和值
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+// MaxBytes 返回允许使用的最大字节数，为 0 表示不限制
+func (c *Cache) MaxBytes() int64 {
+	return c.maxBytes
+}
+
+// Keys 返回当前缓存的所有 key，按最近使用到最久未使用排序
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.ll.Len())
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		keys = append(keys, ele.Value.(*entry).key)
+	}
+	return keys
+}
+
+// writeOrder 是按写入的先后顺序排列的双向链表，更新值不改变记录的位置
+type writeOrder struct {
+	newest *entry
+}
+
+func (o *writeOrder) push(e *entry) {
+	e.older = o.newest
+	if o.newest != nil {
+		o.newest.newer = e
+	}
+	o.newest = e
+}
+
+func (o *writeOrder) remove(e *entry) {
+	if e.older != nil {
+		e.older.newer = e.newer
+	}
+	if e.newer != nil {
+		e.newer.older = e.older
+	} else {
+		o.newest = e.older
+	}
+	e.older, e.newer = nil, nil
+}
+
+// unlink 从 writeOrder 中删除记录，正好停在它上面的 Cursor 移到下一条记录
+func (c *Cache) unlink(e *entry) {
+	for _, cur := range c.cursors {
+		if cur.next == e {
+			cur.next = e.older
+		}
+	}
+	c.order.remove(e)
+}
+
+// Cursor 从最新写入的记录开始分批遍历缓存中的记录，两批之间可以任意修改缓存，调用方可以在每批之间释放锁
+type Cursor interface {
+	// Next 从上次的位置开始访问最多 n 条记录，返回是否还有没有访问的记录，fn 中可以删除正在访问的记录
+	Next(n int, fn func(key string, value Value)) bool
+	// Close 结束遍历，Next 返回 false 时已经自动结束
+	Close()
+}
+
+type cursor struct {
+	c    *Cache
+	next *entry // 下一条要访问的记录
+}
+
+// NewCursor 返回一个从最新写入的记录开始、向最早写入的记录遍历的 Cursor，每次 Next 的开销只与 n 有关，与缓存的大小无关。
+// 遍历期间被删除的记录会被跳过，更新了值或者被访问的记录保持原来的位置，创建之后新写入的记录不会被访问，
+// 因此一直存在的记录恰好被访问一次。没有遍历完时需要调用 Close，否则每次删除记录都要检查它
+func (c *Cache) NewCursor() Cursor {
+	cur := &cursor{c: c, next: c.order.newest}
+	c.cursors = append(c.cursors, cur)
+	return cur
+}
+
+func (cur *cursor) Next(n int, fn func(key string, value Value)) bool {
+	for ; n > 0 && cur.more(); n-- {
+		e := cur.next
+		cur.next = e.older
+		fn(e.key, e.value)
+	}
+	if !cur.more() {
+		cur.Close()
+		return false
+	}
+	return true
+}
+
+func (cur *cursor) more() bool {
+	return cur.next != nil
+}
+
+func (cur *cursor) Close() {
+	if cur.c == nil {
+		return
+	}
+	cursors := cur.c.cursors
+	for i, other := range cursors {
+		if other == cur {
+			cursors[i] = cursors[len(cursors)-1]
+			cursors[len(cursors)-1] = nil
+			cur.c.cursors = cursors[:len(cursors)-1]
+			break
+		}
+	}
+	cur.c, cur.next = nil, nil
+}
@@ -53,3 +53,271 @@ func TestCacheOnEvicted(t *testing.T) {
 		t.Fatalf("Call OnEvicted failed, expect keys equals to %s", expect)
 	}
 }
+
+func TestNewWithCapacity(t *testing.T) {
+	lru := NewWithCapacity(int64(10), 16, nil)
+	lru.Add("key1", String("123456"))
+	lru.Add("k2", String("k2"))
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 1 {
+		t.Fatalf("NewWithCapacity should behave like New")
+	}
+}
+
+// mutable 的 Len 会在插入之后变化
+type mutable struct {
+	n *int
+}
+
+func (m mutable) Len() int {
+	return *m.n
+}
+
+func TestCache_SizeComputedOnce(t *testing.T) {
+	n := 4
+	lru := New(int64(0), nil)
+	lru.Add("key1", mutable{&n})
+	n = 100
+	lru.RemoveOldest()
+	if lru.nbytes != 0 {
+		t.Fatalf("expect nbytes 0 after removal, but %d got", lru.nbytes)
+	}
+}
+
+func TestCache_Remove(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1234"))
+	lru.Add("key2", String("5678"))
+	if !lru.Remove("key1") || lru.Remove("key1") {
+		t.Fatalf("remove key1 failed")
+	}
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 1 || lru.nbytes != 8 {
+		t.Fatalf("key1 should be removed")
+	}
+	if keys := lru.Keys(); !reflect.DeepEqual(keys, []string{"key2"}) {
+		t.Fatalf("expect keys [key2], but %v got", keys)
+	}
+}
+
+func TestCache_RemoveAndGet(t *testing.T) {
+	var evicted []string
+	lru := New(int64(0), func(key string, value Value) { evicted = append(evicted, key) })
+	lru.Add("key1", String("1234"))
+	lru.Add("key2", String("5678"))
+	if v, ok := lru.RemoveAndGet("key1"); !ok || v.(String) != "1234" {
+		t.Fatalf("RemoveAndGet(key1) = %v, %v", v, ok)
+	}
+	if _, ok := lru.RemoveAndGet("key1"); ok {
+		t.Fatalf("key1 should already be removed")
+	}
+	if lru.Len() != 1 || lru.nbytes != 8 || !reflect.DeepEqual(evicted, []string{"key1"}) {
+		t.Fatalf("len = %d, nbytes = %d, evicted = %v", lru.Len(), lru.nbytes, evicted)
+	}
+}
+
+func TestCache_Peek(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1234"))
+	lru.Add("key2", String("5678"))
+	if v, ok := lru.Peek("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("peek key1 failed")
+	}
+	lru.RemoveOldest()
+	if _, ok := lru.Get("key1"); ok {
+		t.Fatalf("peek should not promote key1")
+	}
+}
+
+func TestCache_AddAll(t *testing.T) {
+	entries := []Entry{
+		{"key1", String("123456")},
+		{"k2", String("k2")},
+		{"k3", String("k3")},
+		{"k4", String("k4")},
+	}
+	one := New(int64(10), nil)
+	for _, e := range entries {
+		one.Add(e.Key, e.Value)
+	}
+	bulk := New(int64(10), nil)
+	bulk.AddAll(entries)
+
+	if !reflect.DeepEqual(one.Keys(), bulk.Keys()) || one.nbytes != bulk.nbytes {
+		t.Fatalf("AddAll keys %v, but Add keys %v", bulk.Keys(), one.Keys())
+	}
+
+	// 重复的 key 以最后一个值为准，较大的中间值不会淘汰 e
+	dup := New(int64(12), nil)
+	dup.Add("e", String("eeee"))
+	dup.AddAll([]Entry{{"a", String("aaaaaaa")}, {"a", String("a")}})
+	if keys := dup.Keys(); !reflect.DeepEqual(keys, []string{"a", "e"}) {
+		t.Fatalf("AddAll with duplicate keys kept %v, want [a e]", keys)
+	}
+	if v, _ := dup.Get("a"); string(v.(String)) != "a" || dup.nbytes != int64(len("a")+len("a")+len("eeee")+len("e")) {
+		t.Fatalf("expect the last value of a, but %v got (nbytes %d)", v, dup.nbytes)
+	}
+}
+
+func TestCache_Pin(t *testing.T) {
+	var over int64
+	lru := New(int64(10), nil)
+	lru.OnOverBudget = func(nbytes, maxBytes int64) { over = nbytes }
+	lru.Add("k1", String("v1"))
+	lru.Pin("k1")
+	lru.Add("k2", String("v2"))
+	lru.Add("k3", String("v3"))
+	if _, ok := lru.Get("k1"); !ok {
+		t.Fatalf("pinned k1 should not be evicted")
+	}
+	if _, ok := lru.Get("k2"); ok {
+		t.Fatalf("k2 should be evicted instead of pinned k1")
+	}
+
+	lru.Pin("k3")
+	lru.Add("k3", String("123456789")) // 固定的记录变大，无法通过淘汰回到预算之内
+	if lru.Len() != 2 || over != 15 {
+		t.Fatalf("expect pinned entries to exceed the budget, len %d nbytes %d", lru.Len(), over)
+	}
+
+	lru.Unpin("k1")
+	lru.RemoveOldest()
+	if _, ok := lru.Peek("k1"); ok {
+		t.Fatalf("unpinned k1 should be evictable")
+	}
+}
+
+func TestStringAndBytesValue(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("s", StringValue("1234"))
+	lru.Add("b", BytesValue("123456"))
+	if v, ok := lru.Get("s"); !ok || v.(StringValue) != "1234" {
+		t.Fatalf("cache hit s = 1234 failed")
+	}
+	if v, ok := lru.Get("b"); !ok || string(v.(BytesValue)) != "123456" {
+		t.Fatalf("cache hit b = 123456 failed")
+	}
+	if lru.nbytes != int64(len("s1234b123456")) {
+		t.Fatalf("unexpected nbytes %d", lru.nbytes)
+	}
+}
+
+func TestCache_Swap(t *testing.T) {
+	lru := New(int64(0), nil)
+	if _, existed := lru.Swap("key1", String("1234")); existed {
+		t.Fatalf("key1 should not exist")
+	}
+	old, existed := lru.Swap("key1", String("123456"))
+	if !existed || string(old.(String)) != "1234" {
+		t.Fatalf("expect old value 1234, but %v got", old)
+	}
+	if lru.nbytes != int64(len("key1123456")) {
+		t.Fatalf("unexpected nbytes %d", lru.nbytes)
+	}
+}
+
+func TestCache_KeysOrder(t *testing.T) {
+	lru := New(int64(0), nil)
+	for _, k := range []string{"k1", "k2", "k3", "k4"} {
+		lru.Add(k, String("v"))
+	}
+	lru.Get("k2")
+	lru.Add("k3", String("vv"))
+	lru.Remove("k1")
+
+	expect := []string{"k3", "k2", "k4"}
+	if keys := lru.Keys(); !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("expect keys %v, but %v got", expect, keys)
+	}
+}
+
+func TestCache_Cursor(t *testing.T) {
+	lru := New(int64(0), nil)
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		lru.Add(k, String("v"))
+	}
+	var visited []string
+	visit := func(key string, value Value) { visited = append(visited, key) }
+
+	cur := lru.NewCursor()
+	if !cur.Next(2, visit) {
+		t.Fatal("cursor should have more entries")
+	}
+	lru.Remove("k3")            // 下一条要访问的记录被删除
+	lru.Get("k1")               // 访问不改变写入顺序
+	lru.Add("k2", String("vv")) // 更新值不改变写入顺序
+	lru.Add("k6", String("v"))  // 之后写入的记录不会被访问
+	if cur.Next(10, visit) || len(lru.cursors) != 0 {
+		t.Fatal("cursor should finish and unregister itself")
+	}
+	if expect := []string{"k5", "k4", "k2", "k1"}; !reflect.DeepEqual(expect, visited) {
+		t.Fatalf("expect visited %v, but %v got", expect, visited)
+	}
+
+	// 遍历中删除正在访问的记录
+	visited = nil
+	cur = lru.NewCursor()
+	for cur.Next(1, func(key string, value Value) { visit(key, value); lru.Remove(key) }) {
+	}
+	if lru.Len() != 0 || len(visited) != 5 {
+		t.Fatalf("expect all entries removed, %d left after visiting %v", lru.Len(), visited)
+	}
+}
+
+func TestCacheOnEvictedReentrant(t *testing.T) {
+	var lru *Cache
+	lru = New(int64(12), func(key string, value Value) {
+		if key[0] != '~' { // 被淘汰时写入一个墓碑
+			lru.Add("~"+key, String(""))
+		}
+	})
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		lru.Add(k, String("vv"))
+	}
+
+	var nbytes int64
+	for _, key := range lru.Keys() {
+		v, ok := lru.Peek(key)
+		if !ok {
+			t.Fatalf("key %s listed but missing", key)
+		}
+		nbytes += int64(len(key) + v.Len())
+	}
+	if nbytes != lru.nbytes || lru.nbytes > 12 || lru.Len() != len(lru.cache) {
+		t.Fatalf("inconsistent cache after reentrant OnEvicted: nbytes %d, counted %d", lru.nbytes, nbytes)
+	}
+}
+
+func TestCache_EvictCandidates(t *testing.T) {
+	lru := New(int64(18), nil)
+	lru.EvictCandidates = 2
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("123456"))
+	lru.Add("k3", String("v3"))
+	lru.Add("k4", String("v4"))
+	if _, ok := lru.Peek("k2"); ok {
+		t.Fatalf("the largest of the oldest candidates k2 should be evicted")
+	}
+	if _, ok := lru.Peek("k1"); !ok {
+		t.Fatalf("k1 should survive")
+	}
+}
+
+func TestCache_EvictBy(t *testing.T) {
+	var evicted []string
+	lru := New(0, func(key string, _ Value) { evicted = append(evicted, key) })
+	scores := map[string]int64{"k1": 3, "k2": 1, "k3": 2, "k4": 1}
+	for _, k := range []string{"k1", "k2", "k3", "k4"} {
+		lru.Add(k, String("vv")) // 每条 4 个字节
+	}
+	lru.Pin("k4")
+
+	n := lru.EvictBy(func(key string, _ Value) int64 { return scores[key] }, 8)
+	if want := []string{"k2", "k3"}; n != 2 || !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("EvictBy evicted %d %v, want %v", n, evicted, want)
+	}
+	if lru.nbytes != 8 || lru.Len() != 2 {
+		t.Fatalf("nbytes = %d, len = %d, want 8 and 2", lru.nbytes, lru.Len())
+	}
+	if n := lru.EvictBy(func(string, Value) int64 { return 0 }, 8); n != 0 {
+		t.Fatalf("EvictBy under target evicted %d entries", n)
+	}
+}
@@ -0,0 +1,288 @@
+package lruk
+
+import (
+	"container/heap"
+	"gee-cache/lru"
+	"sort"
+)
+
+// Cache 是一个 LRU-K 缓存。并发不安全。
+// 每条记录保存最近 K 次访问（Add 或 Get）的时间，淘汰时按倒数第 K 次访问的时间（backward K-distance）排序：
+// 访问次数不足 K 次的记录视为距离无穷大，最先淘汰，它们之间按最近一次访问的先后顺序淘汰；
+// 其余记录中倒数第 K 次访问最早的最先淘汰。这样只被扫描过一次的记录不会挤掉被反复访问的记录。
+// 时间使用逻辑时钟，每次访问加一，因此淘汰顺序是确定的。K 为 1 时与普通的 LRU 相同。
+type Cache struct {
+	k        int
+	maxBytes int64 // 允许使用的最大内存
+	nbytes   int64 // 当前已使用的内存
+	clock    uint64
+	cache    map[string]*entry
+	queue    queue // 按淘汰优先级排列的小顶堆，堆顶最先淘汰
+	// 可选，在某条记录被移除时的回调函数
+	// 回调在该记录的字典、堆和 nbytes 都更新完成之后才调用，因此可以在回调中重入 Add、Remove 等方法。
+	OnEvicted func(key string, value Value)
+
+	newest  *entry // 最新写入的记录，所有记录按写入的先后顺序串成双向链表，供 NewCursor 分批遍历
+	cursors []*cursor
+}
+
+var _ lru.EvictionPolicy = (*Cache)(nil)
+
+// Value 与 lru.Value 相同，使用 Len 来返回其在内存中的大小，两种缓存可以存放相同的值
+type Value = lru.Value
+
+type entry struct {
+	key     string
+	value   Value
+	size    int64    // int64(len(key)) + int64(value.Len())
+	history []uint64 // 最近 K 次访问的时间，从旧到新排列
+	index   int      // 在堆中的下标
+
+	older, newer *entry // 按写入顺序的前后记录，更新值时不变
+}
+
+// New 创建一个新的 Cache，k 小于 1 时按 1 处理
+func New(k int, maxBytes int64, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		k:         max(k, 1),
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*entry),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Get 查找一个 key，并记录一次访问
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	if e, ok := c.cache[key]; ok {
+		c.touch(e)
+		return e.value, true
+	}
+	return
+}
+
+// Peek 查找一个 key，但不记录访问，不影响淘汰顺序
+func (c *Cache) Peek(key string) (value Value, ok bool) {
+	if e, ok := c.cache[key]; ok {
+		return e.value, true
+	}
+	return
+}
+
+// Add 向缓存添加一个值，key 已存在时更新值，新增和更新都记录一次访问
+func (c *Cache) Add(key string, value Value) {
+	c.Swap(key, value)
+}
+
+// Swap 与 Add 相同，但是在 key 已存在时返回被替换的旧值
+func (c *Cache) Swap(key string, value Value) (old Value, existed bool) {
+	size := int64(len(key)) + int64(value.Len())
+	if e, ok := c.cache[key]; ok {
+		c.nbytes += size - e.size
+		old, existed = e.value, true
+		e.value = value
+		e.size = size
+		c.touch(e)
+	} else {
+		e := &entry{key: key, value: value, size: size, history: make([]uint64, 0, c.k)}
+		c.cache[key] = e
+		c.nbytes += size
+		c.clock++
+		e.history = append(e.history, c.clock)
+		heap.Push(&c.queue, e)
+		c.push(e)
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes && len(c.queue) > 0 {
+		c.RemoveOldest()
+	}
+	return old, existed
+}
+
+// touch 记录一次访问，只保留最近 K 次
+func (c *Cache) touch(e *entry) {
+	c.clock++
+	if len(e.history) == c.k {
+		copy(e.history, e.history[1:])
+		e.history = e.history[:c.k-1]
+	}
+	e.history = append(e.history, c.clock)
+	heap.Fix(&c.queue, e.index)
+}
+
+// RemoveOldest 移除 backward K-distance 最大的记录
+func (c *Cache) RemoveOldest() {
+	if len(c.queue) > 0 {
+		c.removeEntry(c.queue[0])
+	}
+}
+
+// Remove 移除指定的 key，返回 key 是否存在
+func (c *Cache) Remove(key string) bool {
+	if e, ok := c.cache[key]; ok {
+		c.removeEntry(e)
+		return true
+	}
+	return false
+}
+
+// RemoveAndGet 移除指定的 key 并返回它的值，key 不存在时返回 false。与 Remove 一样会调用 OnEvicted
+func (c *Cache) RemoveAndGet(key string) (value Value, ok bool) {
+	if e, ok := c.cache[key]; ok {
+		c.removeEntry(e)
+		return e.value, true
+	}
+	return nil, false
+}
+
+func (c *Cache) removeEntry(e *entry) {
+	heap.Remove(&c.queue, e.index)
+	c.unlink(e)
+	delete(c.cache, e.key)
+	c.nbytes -= e.size
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// Len 返回当前缓存的元素个数
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes 返回当前已使用的字节数，包括 key 和值
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+// MaxBytes 返回允许使用的最大字节数，为 0 表示不限制
+func (c *Cache) MaxBytes() int64 {
+	return c.maxBytes
+}
+
+// SizeOf 返回 key 计入 nbytes 的字节数，不记录访问
+func (c *Cache) SizeOf(key string) (int64, bool) {
+	if e, ok := c.cache[key]; ok {
+		return e.size, true
+	}
+	return 0, false
+}
+
+// Keys 返回当前缓存的所有 key，按淘汰顺序的逆序排列，最后一个是下一个被淘汰的 key
+func (c *Cache) Keys() []string {
+	q := make(queue, len(c.queue))
+	copy(q, c.queue)
+	sort.Slice(q, func(i, j int) bool { return q.Less(j, i) })
+	keys := make([]string, len(q))
+	for i, e := range q {
+		keys[i] = e.key
+	}
+	return keys
+}
+
+// push 把新写入的记录加到写入顺序的末尾
+func (c *Cache) push(e *entry) {
+	e.older = c.newest
+	if c.newest != nil {
+		c.newest.newer = e
+	}
+	c.newest = e
+}
+
+// unlink 从写入顺序中删除记录，正好停在它上面的 Cursor 移到下一条记录
+func (c *Cache) unlink(e *entry) {
+	for _, cur := range c.cursors {
+		if cur.next == e {
+			cur.next = e.older
+		}
+	}
+	if e.older != nil {
+		e.older.newer = e.newer
+	}
+	if e.newer != nil {
+		e.newer.older = e.older
+	} else {
+		c.newest = e.older
+	}
+	e.older, e.newer = nil, nil
+}
+
+type cursor struct {
+	c    *Cache
+	next *entry
+}
+
+// NewCursor 与 lru.Cache 的 NewCursor 相同，从最新写入的记录开始分批遍历，而不是按淘汰顺序
+func (c *Cache) NewCursor() lru.Cursor {
+	cur := &cursor{c: c, next: c.newest}
+	c.cursors = append(c.cursors, cur)
+	return cur
+}
+
+func (cur *cursor) Next(n int, fn func(key string, value Value)) bool {
+	for ; n > 0 && cur.more(); n-- {
+		e := cur.next
+		cur.next = e.older
+		fn(e.key, e.value)
+	}
+	if !cur.more() {
+		cur.Close()
+		return false
+	}
+	return true
+}
+
+func (cur *cursor) more() bool {
+	return cur.next != nil
+}
+
+func (cur *cursor) Close() {
+	if cur.c == nil {
+		return
+	}
+	cursors := cur.c.cursors
+	for i, other := range cursors {
+		if other == cur {
+			cursors[i] = cursors[len(cursors)-1]
+			cursors[len(cursors)-1] = nil
+			cur.c.cursors = cursors[:len(cursors)-1]
+			break
+		}
+	}
+	cur.c, cur.next = nil, nil
+}
+
+// queue 实现 heap.Interface，堆顶是下一个被淘汰的记录
+type queue []*entry
+
+func (q queue) Len() int { return len(q) }
+
+func (q queue) Less(i, j int) bool {
+	a, b := q[i], q[j]
+	aFull, bFull := len(a.history) == cap(a.history), len(b.history) == cap(b.history)
+	if aFull != bFull {
+		return !aFull // 访问次数不足 K 次的记录先淘汰
+	}
+	if !aFull {
+		return a.history[len(a.history)-1] < b.history[len(b.history)-1]
+	}
+	return a.history[0] < b.history[0]
+}
+
+func (q queue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *queue) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *queue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,106 @@
+package lruk
+
+import (
+	"reflect"
+	"testing"
+
+	"gee-cache/lru"
+)
+
+func TestCache_Get(t *testing.T) {
+	c := New(2, 0, nil)
+	c.Add("key1", lru.StringValue("1234"))
+	if v, ok := c.Get("key1"); !ok || string(v.(lru.StringValue)) != "1234" {
+		t.Fatalf("cache hit key1 = 1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestCache_ScanResistance(t *testing.T) {
+	var evicted []string
+	// 每条记录 2 个字节，最多容纳 3 条
+	c := New(2, 6, func(key string, _ Value) { evicted = append(evicted, key) })
+	c.Add("h", lru.StringValue("1"))
+	c.Get("h") // h 被访问了两次
+	c.Add("a", lru.StringValue("1"))
+	c.Add("b", lru.StringValue("1"))
+	// 扫描流量只访问一次，淘汰的是同样只访问过一次的记录，而不是最久之前写入的 h
+	c.Add("c", lru.StringValue("1"))
+	c.Add("d", lru.StringValue("1"))
+
+	if want := []string{"a", "b"}; !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("evicted = %v, want %v", evicted, want)
+	}
+	if _, ok := c.Peek("h"); !ok || c.Len() != 3 {
+		t.Fatalf("h should survive the scan, len = %d", c.Len())
+	}
+}
+
+func TestCache_KthDistance(t *testing.T) {
+	var evicted []string
+	c := New(2, 0, func(key string, _ Value) { evicted = append(evicted, key) })
+	c.Add("a", lru.StringValue("1"))
+	c.Add("b", lru.StringValue("1"))
+	c.Get("a")
+	c.Get("b")
+	c.Get("a") // a 倒数第二次访问的时间晚于 b 的
+	c.RemoveOldest()
+	if want := []string{"b"}; !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("evicted = %v, want %v", evicted, want)
+	}
+}
+
+func TestCache_K1IsLRU(t *testing.T) {
+	var evicted []string
+	c := New(1, 4, func(key string, _ Value) { evicted = append(evicted, key) })
+	c.Add("a", lru.StringValue("1"))
+	c.Add("b", lru.StringValue("1"))
+	c.Get("a")
+	c.Add("c", lru.StringValue("1"))
+	if want := []string{"b"}; !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("evicted = %v, want %v", evicted, want)
+	}
+}
+
+func TestCache_Remove(t *testing.T) {
+	c := New(2, 0, nil)
+	c.Add("a", lru.StringValue("1"))
+	c.Add("b", lru.StringValue("1"))
+	if !c.Remove("a") || c.Remove("a") || c.Len() != 1 {
+		t.Fatalf("Remove failed, len = %d", c.Len())
+	}
+	c.Add("b", lru.StringValue("123"))
+	if c.nbytes != 4 {
+		t.Fatalf("nbytes = %d, want 4", c.nbytes)
+	}
+	if v, ok := c.RemoveAndGet("b"); !ok || v.(lru.StringValue) != "123" || c.nbytes != 0 {
+		t.Fatalf("RemoveAndGet(b) = %v, %v, nbytes = %d", v, ok, c.nbytes)
+	}
+}
+
+func TestCache_Cursor(t *testing.T) {
+	c := New(2, 0, nil)
+	for _, k := range []string{"k1", "k2", "k3", "k4"} {
+		c.Add(k, lru.StringValue("v"))
+	}
+	var visited []string
+	visit := func(key string, value Value) { visited = append(visited, key) }
+
+	cur := c.NewCursor()
+	cur.Next(1, visit)
+	c.Remove("k3")
+	c.Get("k1")
+	c.Add("k5", lru.StringValue("v"))
+	for cur.Next(1, visit) {
+	}
+	if expect := []string{"k4", "k2", "k1"}; !reflect.DeepEqual(expect, visited) {
+		t.Fatalf("expect visited %v, but %v got", expect, visited)
+	}
+	cur = c.NewCursor()
+	cur.Close()
+	if len(c.cursors) != 0 {
+		t.Fatal("closed cursor should be unregistered")
+	}
+}
@@ -0,0 +1,81 @@
+package gee_cache
+
+// 条目的元数据
+
+// Meta 是与缓存值一起保存的少量元数据，例如 ETag、来源节点、加载时间等。
+// 元数据的 key 和 value 的字节数计入缓存的容量。
+type Meta map[string]string
+
+// size 返回元数据占用的字节数
+func (m Meta) size() int {
+	n := 0
+	for k, v := range m {
+		n += len(k) + len(v)
+	}
+	return n
+}
+
+// clone 返回 m 的副本，避免调用方在写入缓存之后修改元数据，使容量的计算失效
+func (m Meta) clone() Meta {
+	if m == nil {
+		return nil
+	}
+	c := make(Meta, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// SetWithMeta 与 Set 相同，同时为条目附加元数据 meta，覆盖已有的值和元数据
+func (g *Group) SetWithMeta(key string, value []byte, meta Meta) {
+	key = g.normalizeKey(key)
+	if key == "" {
+		return
+	}
+	g.mainCache.addItem(key, &item{value: ByteView{b: cloneBytes(value)}, meta: meta.clone()})
+}
+
+// GetWithMeta 只查询本地缓存，返回 key 的值以及写入时附加的元数据，不会调用 getter。
+// 返回的 Meta 是副本，可以随意修改。没有附加元数据的条目返回 nil。
+func (g *Group) GetWithMeta(key string) (ByteView, Meta, bool) {
+	key = g.normalizeKey(key)
+	if key == "" {
+		return ByteView{}, nil, false
+	}
+	it, _, ok := g.mainCache.getItem(key)
+	if !ok {
+		return ByteView{}, nil, false
+	}
+	return it.value, it.meta.clone(), true
+}
+
+// MetaContentType 是保存值的内容类型（MIME 类型）的元数据 key
+const MetaContentType = "Content-Type"
+
+// DefaultContentType 是没有记录内容类型时使用的类型
+const DefaultContentType = "application/octet-stream"
+
+// ContentTypeGetter 是可以同时返回内容类型的 Getter。getter 实现了它时，加载时调用 GetWithContentType 而不是 Get，
+// 返回的内容类型不为空时保存在条目的元数据中，可以通过 ContentType 获取。
+type ContentTypeGetter interface {
+	Getter
+	GetWithContentType(key string) ([]byte, string, error)
+}
+
+// ContentType 只查询本地缓存，返回 key 的值的内容类型，写入时没有记录内容类型时返回 DefaultContentType。
+// 用 SetWithMeta 写入时可以通过 MetaContentType 指定内容类型。key 不在缓存中时返回 false。
+func (g *Group) ContentType(key string) (string, bool) {
+	key = g.normalizeKey(key)
+	if key == "" {
+		return "", false
+	}
+	it, _, ok := g.mainCache.getItem(key)
+	if !ok {
+		return "", false
+	}
+	if ct := it.meta[MetaContentType]; ct != "" {
+		return ct, true
+	}
+	return DefaultContentType, true
+}
@@ -0,0 +1,269 @@
+package gee_cache
+
+import (
+	"gee-cache/lru"
+	"strconv"
+	"time"
+)
+
+// Group 的可选配置
+
+// Option 用于在 NewGroup 时定制 Group 的行为
+type Option func(g *Group)
+
+// WithOnEvicted 设置条目被淘汰时的回调函数。
+// 回调在并发缓存释放锁之后按淘汰顺序（最久未使用的在前）依次调用，因此可以在回调中安全地访问缓存，
+// 包括重新写入（例如写入一个墓碑条目）或者删除 key。
+func WithOnEvicted(fn func(key string, value ByteView)) Option {
+	return func(g *Group) {
+		g.mainCache.onEvicted = fn
+	}
+}
+
+// WithEvictionHandler 注册一个条目离开缓存时的回调函数，可以注册多个，在 WithOnEvicted 设置的回调之后按注册顺序调用。
+// reasons 不为空时只有离开缓存的原因在其中的条目才会触发回调，例如只在因容量不足被淘汰（InvalidationEvicted）时回写；
+// 为空时与 WithOnEvicted 相同，除了被覆盖之外的所有原因都会触发。被覆盖的旧值只有明确指定了 InvalidationOverwritten 才会触发。
+// 回调的调用时机与 WithOnEvicted 相同，可以在回调中安全地访问缓存。
+func WithEvictionHandler(fn func(key string, value ByteView, reason InvalidationReason), reasons ...InvalidationReason) Option {
+	h := evictionHandler{fn: fn}
+	for _, r := range reasons {
+		h.reasons |= 1 << r
+	}
+	if len(reasons) == 0 {
+		h.reasons = 1<<InvalidationDeleted | 1<<InvalidationEvicted | 1<<InvalidationExpired
+	}
+	return func(g *Group) {
+		g.mainCache.evictionHandlers = append(g.mainCache.evictionHandlers, h)
+	}
+}
+
+// evictionHandler 是通过 WithEvictionHandler 注册的回调函数，reasons 是按 InvalidationReason 的位掩码
+type evictionHandler struct {
+	fn      func(key string, value ByteView, reason InvalidationReason)
+	reasons uint
+}
+
+// WithLoadBackoff 开启加载失败的指数退避：某个 key 加载失败后，在退避窗口内的 Get 直接返回上一次的错误，不再调用 getter。
+// 退避时长从 base 开始，每次连续失败翻倍，最多为 max（max 为 0 时为 10 分钟）。默认不开启。
+func WithLoadBackoff(base, max time.Duration) Option {
+	return func(g *Group) {
+		g.backoff.base = base
+		g.backoff.max = max
+	}
+}
+
+// WithErrorTTL 开启加载错误的缓存：getter 返回错误后，ttl 内对同一个 key 的 Get 直接返回 *CachedError，
+// 不再调用 getter，errors.Is 仍然可以匹配原始错误。它改变了错误的语义，因此默认不开启。
+func WithErrorTTL(ttl time.Duration) Option {
+	return func(g *Group) {
+		g.loadErrors.ttl = ttl
+	}
+}
+
+// WithEvictionAgeTracking 开启被淘汰条目存活时长的统计，结果通过 Stats 获取。
+// 开启后每次插入都需要记录当前时间，因此默认不开启。
+func WithEvictionAgeTracking() Option {
+	return func(g *Group) {
+		g.mainCache.trackAge = true
+	}
+}
+
+// WithBackend 设置外部缓存层，本地缓存未命中时先查询 backend 再调用 getter。为 nil 时直接调用 getter。
+// 它等价于只有一层的 WithLoadStages，会替换之前设置的所有外部缓存层。
+func WithBackend(backend Backend) Option {
+	return WithLoadStages(backend)
+}
+
+// WithLoadStages 设置本地缓存与 getter 之间按顺序查询的多层外部缓存，getter 始终是最后一层。
+// 本地缓存未命中时依次查询 stages，第一个命中的层返回的值写入本地缓存以及它之前未命中的各层，不再查询后面的层；
+// 所有层都未命中时调用 getter，加载的值写入本地缓存和所有层。某一层出错时只记录日志，继续查询下一层。
+// 各层与 getter 共享 WithLoadBudget 设置的时间。stages 中的 nil 会被忽略，没有任何层时直接调用 getter。
+func WithLoadStages(stages ...Backend) Option {
+	return func(g *Group) {
+		g.backends = nil
+		for _, stage := range stages {
+			if stage != nil {
+				g.backends = append(g.backends, stage)
+			}
+		}
+	}
+}
+
+// WithWriteBack 设置脏条目离开缓存（淘汰、删除）之前使用的 Writer，避免 SetDirty 写入的数据丢失。
+// Close 时也会用它写入所有剩余的脏条目。
+func WithWriteBack(w Writer) Option {
+	return func(g *Group) {
+		g.mainCache.writeBack = writeBackFunc(w)
+		g.writer = w
+	}
+}
+
+// WithCloseTimeout 设置 Close 等待进行中的加载、后台刷新和预取结束的最长时间，超时后 Close 继续关闭并返回 ErrCloseTimeout。
+// 为 0 时一直等待，这也是默认值。
+func WithCloseTimeout(timeout time.Duration) Option {
+	return func(g *Group) {
+		g.closeTimeout = timeout
+	}
+}
+
+// WithLoadTimeout 设置单次调用 getter 的最长时间，超时后 Get 返回 ErrLoadTimeout。
+// 超时的 getter 会继续执行，成功后仍然写入缓存，因此超时不会被 WithErrorTTL 缓存，也不计入 WithLoadBackoff 的失败。为 0 时不限制。
+func WithLoadTimeout(timeout time.Duration) Option {
+	return func(g *Group) {
+		g.loadTimeout = timeout
+	}
+}
+
+// WithMaxInFlight 设置一个 key 的加载最长的进行时间，超过后合并等待这次加载的 Get 返回 ErrLoadTimeout，
+// 之后的 Get 重新发起加载，避免一个卡住的 getter 阻塞这个 key 的所有请求。发起加载的 Get 仍然等待 getter 返回。
+// 为 0 时不限制。
+func WithMaxInFlight(d time.Duration) Option {
+	return func(g *Group) {
+		g.loader.MaxInFlight = d
+		g.forceLoader.MaxInFlight = d
+	}
+}
+
+// WithLoadBudget 设置一次加载的总时间，由 backend 和 getter 各个阶段共享：每个阶段只能使用前面阶段剩下的时间，
+// 用完时 Get 返回 ErrDeadlineExceeded，保证加载的总耗时可以预期。与 WithLoadTimeout 同时设置时 getter 取两者中较短的一个。
+// 超时的阶段会继续执行，与 WithLoadTimeout 相同。为 0 时不限制。
+func WithLoadBudget(budget time.Duration) Option {
+	return func(g *Group) {
+		g.loadBudget = budget
+	}
+}
+
+// WithBufferPool 开启缓存值缓冲区的复用：从 getter、backend 加载或者 Set 写入的不超过 size 字节的值使用池中容量为 size 的缓冲区，
+// 条目离开缓存（淘汰、删除、过期或者被覆盖）之后归还到池中，减少高负载下的内存分配和 GC 压力。size 应当取典型的值的长度。
+// 只有值从来没有交给缓存之外的条目才会归还，例如被 Get、GetStale、Snapshot 读取过，或者传给过淘汰回调和 Writer 的值都不会复用，
+// 因此返回的 ByteView 始终有效，不会被其它值覆盖。写入之后很少被读取就被覆盖或者淘汰的值（例如预热、批量刷新）受益最多。默认不开启。
+func WithBufferPool(size int) Option {
+	return func(g *Group) {
+		if size > 0 {
+			g.mainCache.buffers = newBufferPool(size)
+		}
+	}
+}
+
+// WithAccessLog 开启最近访问的环形缓冲区，在内存中保留最近约 size 次 Get 的记录（key 的哈希值、是否命中、耗时），
+// 通过 RecentAccesses 导出，用于事后分析延迟问题。缓冲区按访问的序号轮流分片加锁，即使是同一个热点 key 的并发 Get 也不会争用同一把锁。默认不开启。
+func WithAccessLog(size int) Option {
+	return func(g *Group) {
+		if size > 0 {
+			g.accessLog = newAccessLog(size)
+		}
+	}
+}
+
+// WithSampleRate 设置开销较大的统计（例如 WithAccessLog 的访问记录）的抽样比例，取值为 0 到 1：
+// 例如 0.01 表示只有约 1% 的 Get 会被记录，其余的 Get 只需要一次快速的随机数判断。
+// 小于等于 0 时不记录任何 Get，默认为 1，即记录所有的 Get。它不影响 StartRecording，回放需要完整的访问记录。
+func WithSampleRate(rate float64) Option {
+	return func(g *Group) {
+		g.sampleRate = rate
+	}
+}
+
+// WithVersionHistory 为每个 key 保留最近 k 个版本（包括当前的值）并记录写入时间，用于 GetVersion 按时间读取旧版本。
+// 旧版本的字节数计入缓存的容量，整个 key 被淘汰时所有版本一起离开缓存。k 为 1 时只记录写入时间，
+// 默认不保留旧版本，与 k 为 1 的行为相同但不记录写入时间。
+func WithVersionHistory(k int) Option {
+	return func(g *Group) {
+		g.mainCache.versions = max(k, 0)
+	}
+}
+
+// WithEvictionPolicy 使用 newPolicy 创建的淘汰策略代替默认的 lru.Cache，例如 lruk.New 实现的 LRU-K，方便在同一个 Group 上对比不同的策略。
+// newPolicy 在第一次写入时调用，maxBytes 为 0 表示不限制容量，淘汰条目时必须调用 onEvicted。
+// 使用缓存池时淘汰策略由缓存池决定，此选项不生效；WithLargestFirstEviction 也只对默认的 lru.Cache 生效。
+func WithEvictionPolicy(newPolicy func(maxBytes int64, onEvicted func(key string, value lru.Value)) Policy) Option {
+	return func(g *Group) {
+		g.mainCache.newPolicy = newPolicy
+	}
+}
+
+// WithCopyOnWrite 使用写时复制的缓存代替 lru：所有条目保存在一个不可变的 map 中，Get 只需要一次原子读取和 map 查找，不加锁；
+// 每次写入都复制整个 map 再原子替换，写入的代价与条目数成正比，只适合读多写少、数据量不大的配置类 group。
+// 它不按容量淘汰，cacheBytes 不再生效；Keys 和 Snapshot 按 key 的字典序返回。
+// 不支持与写时复制冲突的功能：WithTTL、WithMaxAge、TTLGetter、WithVersionHistory、WithHashedKeys、缓存池和 WithWriteBack 对它不生效，
+// 条目也不计入 SetGlobalMaxEntries。
+func WithCopyOnWrite() Option {
+	return func(g *Group) {
+		g.mainCache.cow = &cowMap{}
+	}
+}
+
+// WithTTL 设置条目的过期时间：插入之后 fresh 内是新鲜的；fresh 到 hard 之间 Get 仍然返回旧值，同时在后台刷新；
+// 超过 hard 之后视为未命中，Get 会重新加载。hard 小于 fresh 时（包括为 0）等于 fresh，即单一的过期时间。默认永不过期。
+func WithTTL(fresh, hard time.Duration) Option {
+	return func(g *Group) {
+		g.mainCache.freshTTL = fresh
+		g.mainCache.hardTTL = max(hard, fresh)
+	}
+}
+
+// WithMaxAge 设置条目从写入开始最长的存活时间，超过之后即使 TTL 还没有到也视为未命中，Get 会重新加载。
+// 它与 WithTTL 相互独立，用于保证返回的值不会早于某个时间限制。为 0 时不限制。
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(g *Group) {
+		g.mainCache.maxAge = maxAge
+	}
+}
+
+// WithHashedKeys 使用 key 的 SHA-256 哈希值（截断为 16 字节）作为缓存中的 key，字节数按哈希值的长度计算，适合很长的 key。
+// 原始的 key 与值保存在一起，用于在查找时校验哈希冲突，冲突时视为未命中。
+// 开启后 Keys 返回的是哈希值，淘汰回调、失效事件和 Snapshot 中仍然是原始的 key。默认不开启。
+func WithHashedKeys() Option {
+	return func(g *Group) {
+		g.mainCache.hashKeys = true
+	}
+}
+
+// WithValidator 设置 key 的校验函数，在 Get 的最开始调用。返回错误时 Get 直接返回该错误，不会访问缓存，也不会调用 getter。
+func WithValidator(validate func(key string) error) Option {
+	return func(g *Group) {
+		g.validate = validate
+	}
+}
+
+// WithMaxValueBytes 设置从 getter 或者外部缓存加载的值的最大字节数。超过 n 的值在拷贝之前就被拒绝：
+// 它不会写入本地缓存和外部缓存，Get 直接返回 getter 给出的切片，不额外分配内存，因此 getter 不能在返回之后修改它。
+// 之后的 Get 仍然未命中并重新加载。为 0 时不限制。
+func WithMaxValueBytes(n int) Option {
+	return func(g *Group) {
+		g.maxValueLen = n
+	}
+}
+
+// WithNormalizer 设置 key 的规范化函数，例如将 URL 的 host 转为小写、对查询参数排序，使语义相同的 key 共享同一个条目。
+// Get、Set、加载以及其它所有接受 key 的方法都先用 normalize 转换 key，getter、回调、Keys 和 Snapshot 中都是规范形式的 key。
+// normalize 必须是幂等的，即对规范形式再次转换结果不变。为 nil 时使用原始的 key。
+func WithNormalizer(normalize func(key string) string) Option {
+	return func(g *Group) {
+		g.normalize = normalize
+	}
+}
+
+// WithNoCache 设置不可缓存的 key 的判定函数。noCache 返回 true 的 key 每次 Get 都会调用 getter，
+// 加载到的值直接返回给调用方，不写入缓存，也不读写 backend。为 nil 时所有 key 都可以缓存。
+func WithNoCache(noCache func(key string) bool) Option {
+	return func(g *Group) {
+		g.noCache = noCache
+	}
+}
+
+// WithSizeHistogram 开启缓存中值的字节数分布统计（按 2 的幂分桶），结果通过 Stats 获取。默认不开启。
+func WithSizeHistogram() Option {
+	return func(g *Group) {
+		g.mainCache.stats.sizes = make([]int64, strconv.IntSize+1)
+	}
+}
+
+// WithLargestFirstEviction 开启按大小淘汰：容量不足时从最久未使用的 k 个条目中淘汰字节数最大的一个，
+// 用少量大条目换取更多小的热点条目留在缓存中。k 最大为 lru.MaxEvictCandidates。
+// 它改变了严格的 LRU 淘汰语义，因此默认不开启；使用 WithCachePool 时不生效。
+func WithLargestFirstEviction(k int) Option {
+	return func(g *Group) {
+		g.mainCache.evictCandidates = k
+	}
+}
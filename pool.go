@@ -0,0 +1,66 @@
+package gee_cache
+
+import (
+	"gee-cache/lru"
+	"strings"
+	"sync"
+)
+
+// 多个 group 共享的缓存池
+
+// CachePool 让多个 group 共享同一个 LRU 缓存和字节数预算，淘汰按照所有 group 的访问顺序进行，
+// 内存会流向当前更热的 group，而不是静态地按 group 划分。
+// 每个 group 的 key 在缓存池中带有 group 名称作为前缀，不同 group 的 key 不会冲突。
+// 所有使用同一个缓存池的 group 共享同一把锁。
+type CachePool struct {
+	mu     sync.Mutex
+	lru    *lru.Cache
+	active *cache            // 当前持有锁的 cache，被淘汰的条目会收集到它上面
+	caches map[string]*cache // 前缀到 cache 的映射，用于找到被淘汰的条目所属的 group
+}
+
+// NewCachePool 创建一个最多使用 maxBytes 字节的缓存池，maxBytes 为 0 表示不限制
+func NewCachePool(maxBytes int64) *CachePool {
+	p := &CachePool{caches: make(map[string]*cache)}
+	p.lru = lru.New(maxBytes, p.collectEvicted)
+	return p
+}
+
+// WithCachePool 让 group 使用共享的缓存池，此时 NewGroup 的 cacheBytes 参数不再生效。
+// 在同一个缓存池中创建同名的 group 时，旧的 group 留在缓存池中的条目转交给新的 group
+func WithCachePool(p *CachePool) Option {
+	return func(g *Group) {
+		g.mainCache.pool = p
+	}
+}
+
+// register 在所有 Option 生效之后将 c 加入缓存池。同名的 group 会替换之前的 cache，
+// 旧的 cache 的条目带有相同的前缀，之后的淘汰会记录到 c 上，因此把它们的计数和统计一并转移到 c
+func (p *CachePool) register(c *cache, name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c.lru = p.lru
+	c.prefix = name + "\x00"
+	if old := p.caches[c.prefix]; old != nil && old != c {
+		for _, stored := range p.lru.Keys() {
+			if !strings.HasPrefix(stored, c.prefix) {
+				continue
+			}
+			v, _ := p.lru.Peek(stored)
+			n := v.(*item).value.Len()
+			old.addEntries(-1)
+			old.stats.removeSize(n)
+			c.addEntries(1)
+			c.stats.addSize(n)
+		}
+	}
+	p.caches[c.prefix] = c
+}
+
+// collectEvicted 作为共享 lru 的 OnEvicted 回调，根据前缀找到条目所属的 cache
+func (p *CachePool) collectEvicted(key string, value lru.Value) {
+	i := strings.IndexByte(key, 0)
+	owner := p.caches[key[:i+1]]
+	p.active.collect(owner, key, value.(*item))
+}
@@ -0,0 +1,30 @@
+package gee_cache
+
+// 预取
+
+// Prefetch 在后台加载 key，不阻塞调用方，也不返回结果，适合提前加载马上就会用到的 key。
+// key 已经在缓存中时什么也不做（过了新鲜期时与 Get 一样在后台刷新）；否则启动一次加载，与 Get 一样通过 singleflight 合并，之后的 Get 会命中缓存或者等待这次加载。
+// 没有调用方可以接收错误，加载失败时错误被丢弃，但仍然会计入 WithErrorTTL 和 WithLoadBackoff。
+// 只读模式下或者 group 已经关闭时不会加载。
+func (g *Group) Prefetch(key string) {
+	key = g.normalizeKey(key)
+	if key == "" || g.readOnly.Load() || g.closed.Load() {
+		return
+	}
+	if g.validate != nil && g.validate(key) != nil {
+		return
+	}
+	if _, stale, ok := g.mainCache.get(key); ok {
+		if stale {
+			g.refresh(key)
+		}
+		return
+	}
+	if !g.track() {
+		return
+	}
+	go func() {
+		defer g.wg.Done()
+		_, _ = g.load(key)
+	}()
+}
@@ -0,0 +1,118 @@
+package gee_cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// 访问记录与回放，用于离线复现缓存的命中率和淘汰行为
+
+// 每条访问记录的编码为：1 字节操作类型 + uvarint 编码的 key 长度 + key
+const (
+	recordHit  byte = 'h' // 缓存命中
+	recordMiss byte = 'm' // 缓存未命中
+)
+
+// MaxRecordKeyLen 是 ReplayFrom 接受的 key 的最大长度，超过时返回 ErrRecordKeyTooLarge，不会按长度前缀分配内存
+var MaxRecordKeyLen = 64 << 10
+
+// ErrRecordKeyTooLarge 表示访问记录中 key 的长度超过了 MaxRecordKeyLen
+var ErrRecordKeyTooLarge = errors.New("geecache: record key too large")
+
+// recorder 将访问记录写入 w
+type recorder struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	err error // 第一次写入失败的错误，之后的记录都会被丢弃
+}
+
+func (r *recorder) record(op byte, key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return
+	}
+	var buf [1 + binary.MaxVarintLen64]byte
+	buf[0] = op
+	n := 1 + binary.PutUvarint(buf[1:], uint64(len(key)))
+	if _, err := r.w.Write(buf[:n]); err != nil {
+		r.err = err
+		return
+	}
+	_, r.err = r.w.WriteString(key)
+}
+
+func (r *recorder) stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	return r.w.Flush()
+}
+
+// StartRecording 开始将每次 Get 的 key 以及是否命中记录到 w 中，已经在记录时会先停止之前的记录。
+// 未开启记录时 Get 只多一次原子读取。
+func (g *Group) StartRecording(w io.Writer) {
+	if old := g.recorder.Swap(&recorder{w: bufio.NewWriter(w)}); old != nil {
+		_ = old.stop()
+	}
+}
+
+// StopRecording 停止记录，并返回记录期间第一次写入失败的错误
+func (g *Group) StopRecording() error {
+	if r := g.recorder.Swap(nil); r != nil {
+		return r.stop()
+	}
+	return nil
+}
+
+// recordAccess 在开启记录时记录一次访问，并在开启事件流时发送命中或未命中的事件
+func (g *Group) recordAccess(op byte, key string) {
+	if r := g.recorder.Load(); r != nil {
+		r.record(op, key)
+	}
+	if g.events.on.Load() {
+		typ := EventHit
+		if op == recordMiss {
+			typ = EventMiss
+		}
+		g.events.emit(Event{Type: typ, Key: key})
+	}
+}
+
+// ReplayFrom 读取 StartRecording 记录的访问，按顺序对 g 调用 Get，复现相同的访问模式。
+// 是否命中由 g 当前的状态决定，记录中的命中信息只用于对比。
+func ReplayFrom(r io.Reader, g *Group) error {
+	br := bufio.NewReader(r)
+	for {
+		op, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if op != recordHit && op != recordMiss {
+			return fmt.Errorf("geecache: invalid record op %q", op)
+		}
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return fmt.Errorf("geecache: truncated record: %w", err)
+		}
+		if n > uint64(MaxRecordKeyLen) {
+			return fmt.Errorf("%w: %d bytes", ErrRecordKeyTooLarge, n)
+		}
+		key := make([]byte, n)
+		if _, err := io.ReadFull(br, key); err != nil {
+			return fmt.Errorf("geecache: truncated record: %w", err)
+		}
+		_, _ = g.Get(string(key))
+	}
+}
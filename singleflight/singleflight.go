@@ -0,0 +1,84 @@
+package singleflight
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// 防止缓存击穿：对同一个 key 的并发请求只执行一次
+
+// ErrTimeout 表示等待的请求超过了 MaxInFlight 仍未结束
+var ErrTimeout = errors.New("singleflight: in-flight call timed out")
+
+// call 代表正在进行中，或已经结束的请求
+type call struct {
+	done    chan struct{} // 请求结束时关闭
+	timeout chan struct{} // 请求超过 MaxInFlight 时关闭，为 nil 时不限制
+	val     interface{}
+	err     error
+}
+
+// Group 管理不同 key 的请求(call)
+type Group struct {
+	// MaxInFlight 是一次请求最长的进行时间，为 0 时不限制。
+	// 超过后等待该请求的调用方返回 ErrTimeout，并且 key 的请求被移出 m，之后的调用会重新发起请求；
+	// 发起请求的调用方仍然等待 fn 返回，得到 fn 的结果。
+	MaxInFlight time.Duration
+
+	mu sync.Mutex // 保护 m
+	m  map[string]*call
+}
+
+// Do 针对相同的 key，无论 Do 被调用多少次，函数 fn 都只会被调用一次，等待 fn 调用结束了，返回返回值或错误。
+func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.m == nil { // 延迟初始化
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok { // 如果请求正在进行中，则等待
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.val, c.err
+		case <-c.timeout: // timeout 为 nil 时永远不会就绪
+			return nil, ErrTimeout
+		}
+	}
+	c := &call{done: make(chan struct{})}
+	g.m[key] = c // 添加到 g.m，表明 key 已经有对应的请求在处理
+	if g.MaxInFlight > 0 {
+		c.timeout = make(chan struct{})
+		timer := time.AfterFunc(g.MaxInFlight, func() {
+			g.mu.Lock()
+			g.forget(key, c)
+			g.mu.Unlock()
+			close(c.timeout)
+		})
+		defer timer.Stop()
+	}
+	g.mu.Unlock()
+
+	c.val, c.err = fn() // 调用 fn，发起请求
+	close(c.done)       // 请求结束
+
+	g.mu.Lock()
+	g.forget(key, c) // 更新 g.m
+	g.mu.Unlock()
+
+	return c.val, c.err
+}
+
+// forget 在 key 对应的仍是 c 时将其移出 m，超时后 key 可能已经有了新的请求，不能误删，调用方需持有 mu
+func (g *Group) forget(key string, c *call) {
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+}
+
+// InFlight 返回正在进行中的请求数，即当前有请求在处理的 key 的数量
+func (g *Group) InFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.m)
+}
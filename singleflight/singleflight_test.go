@@ -0,0 +1,74 @@
+package singleflight
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	v, err := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil {
+		t.Errorf("Do v = %v, error = %v", v, err)
+	}
+}
+
+func TestDoDupSuppress(t *testing.T) {
+	var g Group
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _ := g.Do("key", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(20 * time.Millisecond)
+				return "bar", nil
+			})
+			if v != "bar" {
+				t.Errorf("Do v = %v", v)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("expect fn called once, but %d got", calls)
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	g := Group{MaxInFlight: 20 * time.Millisecond}
+	release := make(chan struct{})
+	leader := make(chan error, 1)
+	go func() {
+		_, err := g.Do("key", func() (interface{}, error) {
+			<-release
+			return "slow", nil
+		})
+		leader <- err
+	}()
+	for g.InFlight() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := g.Do("key", func() (interface{}, error) { return "dup", nil }); err != ErrTimeout {
+		t.Fatalf("waiter err = %v, want ErrTimeout", err)
+	}
+	if n := g.InFlight(); n != 0 {
+		t.Fatalf("InFlight() = %d after timeout, want 0", n)
+	}
+	// 超时后 key 的请求重新发起
+	if v, err := g.Do("key", func() (interface{}, error) { return "fresh", nil }); v != "fresh" || err != nil {
+		t.Fatalf("Do after timeout = %v, %v, want fresh", v, err)
+	}
+
+	close(release)
+	if err := <-leader; err != nil {
+		t.Fatalf("leader err = %v", err)
+	}
+}
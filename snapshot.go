@@ -0,0 +1,86 @@
+package gee_cache
+
+import "strings"
+
+// 缓存内容的快照
+
+// KeyValue 是快照中的一条记录
+type KeyValue struct {
+	Key   string
+	Value ByteView
+}
+
+// Snapshot 在持有锁的情况下一次性拷贝所有的 key 和值，遍历可以在锁外进行。返回的是原始的 key。
+// 返回的结果是一致的快照，按最近使用到最久未使用排序，但拷贝期间会阻塞其它访问，缓存很大时可以使用 SnapshotChunked。
+func (g *Group) Snapshot() []KeyValue {
+	return g.mainCache.snapshot()
+}
+
+// SnapshotChunked 分批拷贝所有的 key 和值，每次持有锁只拷贝 chunkSize 条记录，与条目总数无关，减少对其它访问的阻塞。
+// 代价是结果不再是一致的快照：分批期间被删除的 key 会被跳过，新加入的 key 不会出现在结果中，值可能来自不同时刻；
+// 结果按写入的先后顺序从新到旧排列，写入之后被访问的 key 不会因此移动，一直存在的 key 恰好出现一次。
+func (g *Group) SnapshotChunked(chunkSize int) []KeyValue {
+	c := &g.mainCache
+	if chunkSize <= 0 || c.cow != nil { // 写时复制的缓存拷贝时不持有锁，不需要分批
+		return g.Snapshot()
+	}
+	kvs := make([]KeyValue, 0, c.len())
+	var w chunkWalk
+	for more := true; more; {
+		c.lock()
+		more = c.nextChunk(&w, chunkSize, func(stored string, it *item) {
+			it.shared = true
+			kvs = append(kvs, KeyValue{Key: it.keyOf(stored), Value: it.value})
+		})
+		c.unlock()
+	}
+	return kvs
+}
+
+func (c *cache) snapshot() []KeyValue {
+	if c.cow != nil {
+		cur := c.cow.load() // 同一个不可变的 map，天然是一致的快照
+		kvs := make([]KeyValue, 0, len(cur))
+		for _, key := range sortedKeys(cur) {
+			kvs = append(kvs, KeyValue{Key: key, Value: cur[key].value})
+		}
+		return kvs
+	}
+	c.lock()
+	defer c.unlock()
+
+	if c.lru == nil {
+		return nil
+	}
+	keys := c.storedKeys()
+	kvs := make([]KeyValue, 0, len(keys))
+	for _, stored := range keys {
+		v, _ := c.lru.Peek(stored)
+		it := v.(*item)
+		it.shared = true
+		kvs = append(kvs, KeyValue{Key: it.keyOf(stored), Value: it.value})
+	}
+	return kvs
+}
+
+// keys 返回当前所有的 key（使用 WithHashedKeys 时为哈希值），按最近使用到最久未使用排序
+func (c *cache) keys() []string {
+	if c.cow != nil {
+		return sortedKeys(c.cow.load())
+	}
+	keys := c.lockedStoredKeys()
+	if c.prefix != "" {
+		for i, key := range keys {
+			keys[i] = strings.TrimPrefix(key, c.prefix)
+		}
+	}
+	return keys
+}
+
+// lockedStoredKeys 加锁后返回 storedKeys
+func (c *cache) lockedStoredKeys() []string {
+	c.lock()
+	defer c.unlock()
+
+	return c.storedKeys()
+}
@@ -0,0 +1,171 @@
+package gee_cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// 快照的持久化，格式由 SnapshotCodec 决定
+
+// ErrSnapshotFormat 表示快照的格式与使用的 SnapshotCodec 不匹配，或者内容已经损坏
+var ErrSnapshotFormat = errors.New("geecache: invalid snapshot format")
+
+// SnapshotCodec 决定 SnapshotTo 和 RestoreFrom 使用的序列化格式，包括分帧和压缩
+type SnapshotCodec interface {
+	NewEncoder(w io.Writer) (SnapshotEncoder, error)
+	NewDecoder(r io.Reader) (SnapshotDecoder, error)
+}
+
+// SnapshotEncoder 依次写入快照中的记录，Close 写入剩余的数据，但不关闭底层的 io.Writer
+type SnapshotEncoder interface {
+	Encode(kv KeyValue) error
+	Close() error
+}
+
+// SnapshotDecoder 依次读取快照中的记录，没有更多记录时返回 io.EOF，格式不匹配时返回 ErrSnapshotFormat
+type SnapshotDecoder interface {
+	Decode() (KeyValue, error)
+}
+
+// BinarySnapshotCodec 是默认的快照格式：固定的文件头之后，每条记录依次是 WriteByteView 编码的 key 和值
+type BinarySnapshotCodec struct{}
+
+// binarySnapshotMagic 是 BinarySnapshotCodec 的文件头，用于识别格式不匹配的输入
+var binarySnapshotMagic = []byte("GEESNAP1")
+
+// NewEncoder 实现 SnapshotCodec 接口
+func (BinarySnapshotCodec) NewEncoder(w io.Writer) (SnapshotEncoder, error) {
+	if _, err := w.Write(binarySnapshotMagic); err != nil {
+		return nil, err
+	}
+	return binaryEncoder{w}, nil
+}
+
+// NewDecoder 实现 SnapshotCodec 接口
+func (BinarySnapshotCodec) NewDecoder(r io.Reader) (SnapshotDecoder, error) {
+	magic := make([]byte, len(binarySnapshotMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, binarySnapshotMagic) {
+		return nil, fmt.Errorf("%w: missing binary snapshot header", ErrSnapshotFormat)
+	}
+	return binaryDecoder{r}, nil
+}
+
+type binaryEncoder struct{ w io.Writer }
+
+func (e binaryEncoder) Encode(kv KeyValue) error {
+	if err := WriteByteView(e.w, ByteView{b: []byte(kv.Key)}); err != nil {
+		return err
+	}
+	return WriteByteView(e.w, kv.Value)
+}
+
+func (e binaryEncoder) Close() error { return nil }
+
+type binaryDecoder struct{ r io.Reader }
+
+func (d binaryDecoder) Decode() (KeyValue, error) {
+	key, err := ReadByteView(d.r)
+	if err != nil {
+		return KeyValue{}, err // 记录之间结束时是 io.EOF
+	}
+	value, err := ReadByteView(d.r)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return KeyValue{}, fmt.Errorf("%w: %v", ErrSnapshotFormat, err)
+	}
+	return KeyValue{Key: key.String(), Value: value}, nil
+}
+
+// GzipSnapshotCodec 用 gzip 压缩 Inner 的输出，Inner 为 nil 时使用 BinarySnapshotCodec
+type GzipSnapshotCodec struct {
+	Inner SnapshotCodec
+}
+
+func (c GzipSnapshotCodec) inner() SnapshotCodec {
+	if c.Inner == nil {
+		return BinarySnapshotCodec{}
+	}
+	return c.Inner
+}
+
+// NewEncoder 实现 SnapshotCodec 接口
+func (c GzipSnapshotCodec) NewEncoder(w io.Writer) (SnapshotEncoder, error) {
+	zw := gzip.NewWriter(w)
+	enc, err := c.inner().NewEncoder(zw)
+	if err != nil {
+		return nil, err
+	}
+	return gzipEncoder{enc, zw}, nil
+}
+
+// NewDecoder 实现 SnapshotCodec 接口
+func (c GzipSnapshotCodec) NewDecoder(r io.Reader) (SnapshotDecoder, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotFormat, err)
+	}
+	return c.inner().NewDecoder(zr)
+}
+
+type gzipEncoder struct {
+	SnapshotEncoder
+	zw *gzip.Writer
+}
+
+func (e gzipEncoder) Close() error {
+	if err := e.SnapshotEncoder.Close(); err != nil {
+		return err
+	}
+	return e.zw.Close()
+}
+
+// SnapshotTo 将 Snapshot 的结果按 codec 的格式写入 w，codec 为 nil 时使用 BinarySnapshotCodec。
+// 只保存 key 和值，元数据、过期时间和脏标记不会被保存。
+func (g *Group) SnapshotTo(w io.Writer, codec SnapshotCodec) error {
+	if codec == nil {
+		codec = BinarySnapshotCodec{}
+	}
+	enc, err := codec.NewEncoder(w)
+	if err != nil {
+		return err
+	}
+	for _, kv := range g.Snapshot() {
+		if err := enc.Encode(kv); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// RestoreFrom 读取 SnapshotTo 写入的快照并写入缓存，返回写入的条目数，codec 必须与写入时相同，为 nil 时使用 BinarySnapshotCodec。
+// 先读取并校验整个快照再写入，格式不匹配或者内容损坏时返回错误，不会写入任何条目。
+// 写入按快照中从最久未使用到最近使用的顺序进行，恢复之后的淘汰顺序与快照时相同。
+func (g *Group) RestoreFrom(r io.Reader, codec SnapshotCodec) (int, error) {
+	if codec == nil {
+		codec = BinarySnapshotCodec{}
+	}
+	dec, err := codec.NewDecoder(r)
+	if err != nil {
+		return 0, err
+	}
+	var kvs []KeyValue
+	for {
+		kv, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		kvs = append(kvs, kv)
+	}
+	for i := len(kvs) - 1; i >= 0; i-- {
+		g.Set(kvs[i].Key, kvs[i].Value.b)
+	}
+	return len(kvs), nil
+}
@@ -0,0 +1,143 @@
+package gee_cache
+
+import (
+	"errors"
+	"gee-cache/lru"
+	"sync/atomic"
+)
+
+// 双缓冲刷新：在备用缓存中准备好新数据，再整体替换当前缓存
+
+// ErrInvalidStandby 表示备用缓存已经提交过，或者不是由这个 group 的 BeginRefresh 创建的
+var ErrInvalidStandby = errors.New("geecache: standby already committed or from another group")
+
+// Standby 是 BeginRefresh 返回的备用缓存，写入它不会影响 group 当前的缓存，CommitRefresh 时整体替换。
+// 它的方法可以并发调用
+type Standby struct {
+	g         *Group
+	c         cache       // 备用缓存，容量、淘汰策略和过期时间等配置与 group 的缓存相同，没有回调
+	owner     *cache      // c.lru 淘汰条目时记录到的 cache，提交之前是 c，提交之后是 group 的缓存
+	committed atomic.Bool // 是否已经提交
+}
+
+// BeginRefresh 创建一个空的备用缓存，用于周期性地整体刷新数据。与 ReplaceAll 不同，准备新数据期间不持有 group 的锁，
+// 提交时也只在锁内交换一次淘汰策略的指针，并发的 Get 始终命中当前的缓存，不会被大批量的写入阻塞。
+// 使用缓存池时 lru 与其它 group 共享，无法整体交换，CommitRefresh 会退化为 ReplaceAll；写时复制的缓存本身就是一次替换，同样使用 ReplaceAll。
+func (g *Group) BeginRefresh() *Standby {
+	c := &g.mainCache
+	s := &Standby{g: g}
+	s.c = cache{
+		cacheBytes:      c.cacheBytes,
+		evictCandidates: c.evictCandidates,
+		newPolicy:       c.newPolicy,
+		trackAge:        c.trackAge,
+		freshTTL:        c.freshTTL,
+		hardTTL:         c.hardTTL,
+		maxAge:          c.maxAge,
+		hashKeys:        c.hashKeys,
+		versions:        c.versions,
+	}
+	if c.pool != nil {
+		s.c.cacheBytes = UnlimitedBytes // 提交时由缓存池的容量决定淘汰哪些条目
+	}
+	if c.stats.sizes != nil {
+		s.c.stats.sizes = make([]int64, len(c.stats.sizes))
+	}
+	s.owner = &s.c
+	// 提前创建 lru，使淘汰回调经过 owner，提交之后淘汰的条目记录到 group 的缓存中
+	collect := func(key string, value lru.Value) { s.owner.collectEvicted(key, value) }
+	maxBytes := max(s.c.cacheBytes, 0)
+	if s.c.newPolicy != nil {
+		s.c.lru = s.c.newPolicy(maxBytes, collect)
+	} else {
+		l := lru.New(maxBytes, collect)
+		l.EvictCandidates = s.c.evictCandidates
+		s.c.lru = l
+	}
+	return s
+}
+
+// Set 将 key 写入备用缓存，提交之前 group 的 Get 看不到它。提交之后调用 Set 不会有任何效果
+func (s *Standby) Set(key string, value []byte) {
+	if key = s.g.normalizeKey(key); key == "" || s.committed.Load() {
+		return
+	}
+	s.c.addItem(key, &item{value: ByteView{b: s.g.mainCache.buffers.clone(value)}})
+}
+
+// Len 返回备用缓存当前的条目数
+func (s *Standby) Len() int {
+	return s.c.len()
+}
+
+// CommitRefresh 用备用缓存替换 group 当前缓存的所有内容，BeginRefresh 之后直接写入 group 的修改会被丢弃。
+// 旧的条目在交换之后按 InvalidationDeleted 触发淘汰回调，备用缓存中的条目重新分配版本号，CompareAndSwap 不会与旧的版本号混淆。
+// 每个备用缓存只能提交一次，重复提交或者提交其它 group 的备用缓存返回 ErrInvalidStandby。
+func (g *Group) CommitRefresh(s *Standby) error {
+	if s.g != g || !s.committed.CompareAndSwap(false, true) {
+		return ErrInvalidStandby
+	}
+	c := &g.mainCache
+	s.c.lock() // 等待进行中的 Set 结束，提交期间一直持有
+	defer s.c.unlock()
+
+	keys := s.c.lru.Keys() // 从最近使用到最久未使用
+	if c.pool != nil || c.cow != nil || c.disabled() {
+		items := make(map[string]*item, len(keys))
+		for _, stored := range keys {
+			v, _ := s.c.lru.Peek(stored)
+			it := v.(*item)
+			items[it.keyOf(stored)] = &item{value: it.value, meta: it.meta}
+		}
+		totalEntries.Add(-int64(s.c.entries))
+		s.c.lru, s.c.entries = nil, 0
+		c.replaceAll(items)
+		return nil
+	}
+
+	// 在锁外为新条目预留并分配版本号，最久未使用的条目版本号最小
+	c.lock()
+	base := c.version
+	c.version += uint64(len(keys))
+	c.unlock()
+	added := make([]string, len(keys))
+	for i, stored := range keys {
+		v, _ := s.c.lru.Peek(stored)
+		it := v.(*item)
+		it.version = base + uint64(len(keys)-i)
+		added[i] = it.keyOf(stored)
+	}
+
+	c.lock()
+	old, oldEntries := c.lru, c.entries
+	c.lru, c.entries = s.c.lru, s.c.entries
+	uncounted := oldEntries // 交换之后需要从条目总数中减去的条目数
+	if c.untracked {        // 备用缓存的条目已经计入总数，但 c 已经不再计入
+		uncounted = s.c.entries
+	}
+	if c.stats.sizes != nil {
+		c.stats.sizes = s.c.stats.sizes
+	}
+	c.stats.evictions += s.c.stats.evictions
+	s.owner = c
+	c.unlock()
+	s.c.lru, s.c.entries = nil, 0
+	totalEntries.Add(-int64(uncounted))
+
+	// 旧的 lru 已经不可见，在锁外按最久未使用的在前回调
+	var evicted []evictedEntry
+	if old != nil {
+		oldKeys := old.Keys()
+		evicted = make([]evictedEntry, 0, len(oldKeys))
+		for i := len(oldKeys) - 1; i >= 0; i-- {
+			v, _ := old.Peek(oldKeys[i])
+			it := v.(*item)
+			evicted = append(evicted, evictedEntry{key: it.keyOf(oldKeys[i]), item: it, reason: InvalidationDeleted, owner: c})
+		}
+	}
+	c.notifyEvicted(evicted)
+	for _, key := range added {
+		c.notifyAdded(key)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package gee_cache
+
+import (
+	"container/list"
+	"math/bits"
+	"sort"
+	"time"
+	"unsafe"
+)
+
+// 缓存的统计信息
+
+// Stats 是 group 统计信息的快照
+type Stats struct {
+	Evictions int64 // 因容量不足被淘汰的条目数
+
+	// 被淘汰条目的存活时长（从插入到淘汰），只有通过 WithEvictionAgeTracking 开启后才会统计。
+	// 存活时长很短说明缓存容量过小，条目刚插入不久就被淘汰。
+	EvictionAgeP50 time.Duration
+	EvictionAgeP99 time.Duration
+
+	// 当前缓存中值的字节数分布，只有通过 WithSizeHistogram 开启后才会统计。
+	// 第 i 个桶统计字节数在 [2^(i-1), 2^i) 之间的值，第 0 个桶统计长度为 0 的值。
+	SizeHistogram []int64
+}
+
+// evictionAgeSamples 是保留的最近被淘汰条目存活时长的样本数
+const evictionAgeSamples = 1024
+
+// cacheStats 记录 cache 的统计信息，调用方需持有 cache 的锁
+type cacheStats struct {
+	evictions int64
+	hits      int64           // 在缓存中找到的查找次数，用于 VictimLowestHitRate
+	misses    int64           // 没有在缓存中找到（包括已过期）的查找次数
+	ages      []time.Duration // 最近被淘汰条目的存活时长，环形缓冲区
+	agesNext  int             // 下一个写入 ages 的位置
+	sizes     []int64         // 值的字节数分布，为 nil 时不统计
+}
+
+// addSize 记录一个插入的值
+func (s *cacheStats) addSize(n int) {
+	if s.sizes != nil {
+		s.sizes[bits.Len(uint(n))]++
+	}
+}
+
+// removeSize 记录一个离开缓存的值
+func (s *cacheStats) removeSize(n int) {
+	if s.sizes != nil {
+		s.sizes[bits.Len(uint(n))]--
+	}
+}
+
+// recordEvictions 将一批因容量不足被淘汰的条目记录到其所属的 cache 的统计信息中，调用方需持有锁
+func recordEvictions(evicted []evictedEntry) {
+	for _, e := range evicted {
+		if e.reason != InvalidationEvicted {
+			continue
+		}
+		s := &e.owner.stats
+		s.evictions++
+		if e.item.added.IsZero() {
+			continue
+		}
+		age := time.Since(e.item.added)
+		if len(s.ages) < evictionAgeSamples {
+			s.ages = append(s.ages, age)
+			continue
+		}
+		s.ages[s.agesNext] = age
+		s.agesNext = (s.agesNext + 1) % evictionAgeSamples
+	}
+}
+
+func (s *cacheStats) snapshot() Stats {
+	st := Stats{Evictions: s.evictions}
+	if s.sizes != nil {
+		// 去掉末尾的空桶
+		n := len(s.sizes)
+		for n > 0 && s.sizes[n-1] == 0 {
+			n--
+		}
+		st.SizeHistogram = make([]int64, n)
+		copy(st.SizeHistogram, s.sizes)
+	}
+	if len(s.ages) > 0 {
+		ages := make([]time.Duration, len(s.ages))
+		copy(ages, s.ages)
+		sort.Slice(ages, func(i, j int) bool { return ages[i] < ages[j] })
+		st.EvictionAgeP50 = percentile(ages, 0.50)
+		st.EvictionAgeP99 = percentile(ages, 0.99)
+	}
+	return st
+}
+
+// percentile 返回已排序的 sorted 中的 q 分位数
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	return sorted[int(float64(len(sorted)-1)*q)]
+}
+
+// Stats 返回 group 当前统计信息的快照
+func (g *Group) Stats() Stats {
+	return g.mainCache.snapshotStats()
+}
+
+// 每个条目在计入容量的字节数之外占用的堆内存的估算值，用于 EstimatedHeapBytes
+const (
+	policyEntrySize = 48                     // lru 中的 entry：key、值的接口、size 和 pinned
+	mapSlotSize     = (16 + 8 + 1) * 16 / 13 // map 的一个槽位：string 头、指针和 tophash，按 map 约 13/16 的装载因子放大
+)
+
+// entryOverhead 是每个条目的固定开销：链表节点、lru 的 entry、map 的槽位以及 item 本身
+var entryOverhead = uint64(unsafe.Sizeof(list.Element{})) + policyEntrySize + mapSlotSize + uint64(unsafe.Sizeof(item{}))
+
+// EstimatedHeapBytes 估算 group 的缓存实际占用的堆内存，在计入容量的字节数（key、值、元数据和历史版本）之上
+// 加上每个条目的链表节点、map 槽位和 item 等固定开销，用于解释 cacheBytes 与进程实际内存之间的差距。
+// 这是按 Go 运行时的内存布局建立的估算模型，不包括 Go 分配器的取整和碎片，也不调用 runtime.ReadMemStats：
+// 后者统计的是整个进程，无法区分各个 group。它需要遍历所有条目，只适合用于诊断，不要在热路径上调用。
+func (g *Group) EstimatedHeapBytes() uint64 {
+	return g.mainCache.estimatedHeapBytes()
+}
+
+func (c *cache) estimatedHeapBytes() uint64 {
+	if c.cow != nil {
+		var total uint64
+		for key, it := range c.cow.load() {
+			total += uint64(len(key)+it.Len()) + mapSlotSize + uint64(unsafe.Sizeof(item{}))
+		}
+		return total
+	}
+	c.lock()
+	defer c.unlock()
+
+	var total uint64
+	for _, stored := range c.storedKeys() {
+		if n, ok := c.lru.SizeOf(stored); ok {
+			total += uint64(n) + entryOverhead
+		}
+	}
+	return total
+}
@@ -0,0 +1,104 @@
+package gee_cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// 失效事件的订阅
+
+// InvalidationReason 是条目失效的原因
+type InvalidationReason int
+
+const (
+	InvalidationDeleted     InvalidationReason = iota // 被显式删除
+	InvalidationEvicted                               // 因容量不足被淘汰
+	InvalidationOverwritten                           // 被新值覆盖
+	InvalidationExpired                               // 超过了过期时间
+)
+
+func (r InvalidationReason) String() string {
+	switch r {
+	case InvalidationDeleted:
+		return "deleted"
+	case InvalidationEvicted:
+		return "evicted"
+	case InvalidationOverwritten:
+		return "overwritten"
+	case InvalidationExpired:
+		return "expired"
+	}
+	return "unknown"
+}
+
+// InvalidationEvent 表示一个 key 失效了
+type InvalidationEvent struct {
+	Key    string
+	Reason InvalidationReason
+}
+
+// subscriberBuffer 是每个订阅 channel 的缓冲区大小
+const subscriberBuffer = 64
+
+// subscribers 管理失效事件的订阅者
+type subscribers struct {
+	mu     sync.RWMutex
+	n      atomic.Int32 // 订阅者数量，没有订阅者时 publish 不需要加锁
+	chans  []chan InvalidationEvent
+	closed bool
+}
+
+// Subscribe 订阅 group 的失效事件：key 被删除、淘汰、覆盖或者过期时都会发送一个事件。
+// 每个订阅者拥有独立的带缓冲的 channel，缓冲区满时新的事件会被丢弃，慢的订阅者不会阻塞缓存。
+// 关闭 group 时所有订阅的 channel 都会被关闭。
+func (g *Group) Subscribe() <-chan InvalidationEvent {
+	return g.subscribers.subscribe()
+}
+
+func (s *subscribers) subscribe() <-chan InvalidationEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan InvalidationEvent, subscriberBuffer)
+	if s.closed {
+		close(ch)
+		return ch
+	}
+	s.chans = append(s.chans, ch)
+	s.n.Add(1)
+	return ch
+}
+
+// publish 向所有订阅者发送事件，不会阻塞
+func (s *subscribers) publish(key string, reason InvalidationReason) {
+	if s.n.Load() == 0 {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return
+	}
+	event := InvalidationEvent{Key: key, Reason: reason}
+	for _, ch := range s.chans {
+		select {
+		case ch <- event:
+		default: // 缓冲区已满，丢弃事件
+		}
+	}
+}
+
+func (s *subscribers) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for _, ch := range s.chans {
+		close(ch)
+	}
+	s.chans = nil
+}
@@ -0,0 +1,61 @@
+package gee_cache
+
+import (
+	"math"
+	"time"
+)
+
+// 过期时间
+
+// TTLGetter 是可以为每个值给出过期时间的 Getter，例如根据上游的 Cache-Control 决定。getter 实现了它时，加载时调用 GetWithTTL 而不是 Get，
+// 返回的 ttl 大于 0 时代替 group 的 TTL 作为这个条目的新鲜期；设置了 WithTTL 的后台刷新窗口时，条目的刷新窗口按 hard 与 fresh 的比例
+// 由 ttl 换算，例如 WithTTL(time.Minute, 2*time.Minute) 时 ttl 为 10 秒的条目在 10 到 20 秒之间后台刷新。为 0 时使用 group 的 TTL。
+// WithMaxAge 的上限仍然有效。还需要返回内容类型时实现 TTLContentTypeGetter。
+type TTLGetter interface {
+	Getter
+	GetWithTTL(key string) ([]byte, time.Duration, error)
+}
+
+// TTLContentTypeGetter 是同时给出过期时间和内容类型的 Getter，getter 实现了它时，加载时只调用一次 GetWithTTLAndContentType，
+// 返回的 ttl 与 TTLGetter 相同，内容类型与 ContentTypeGetter 相同。
+// 只实现了 TTLGetter 和 ContentTypeGetter 的 getter 调用 GetWithTTL，不会为了内容类型再加载一次。
+type TTLContentTypeGetter interface {
+	Getter
+	GetWithTTLAndContentType(key string) ([]byte, string, time.Duration, error)
+}
+
+// staleWindow 返回 getter 给出的新鲜期 ttl 对应的后台刷新窗口，按 WithTTL 中刷新窗口与 fresh 的比例换算，没有刷新窗口时为 0。
+// fresh 为 0 时条目写入后立即需要刷新，窗口不随 ttl 缩放，直接使用 hard
+func (c *cache) staleWindow(ttl time.Duration) time.Duration {
+	stale := c.hardTTL - c.freshTTL
+	if stale <= 0 {
+		return 0
+	}
+	if c.freshTTL <= 0 {
+		return stale
+	}
+	w := float64(ttl) * (float64(stale) / float64(c.freshTTL))
+	if w >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(w)
+}
+
+// refresh 在后台重新加载一个已经过了新鲜期但还没有过期的 key，同一个 key 同时只会有一次刷新
+func (g *Group) refresh(key string) {
+	if g.readOnly.Load() || g.closed.Load() {
+		return
+	}
+	if _, loaded := g.refreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	if !g.track() {
+		g.refreshing.Delete(key)
+		return
+	}
+	go func() {
+		defer g.wg.Done()
+		defer g.refreshing.Delete(key)
+		_, _ = g.load(key)
+	}()
+}
@@ -0,0 +1,67 @@
+package gee_cache
+
+// 带类型的 Group 封装
+
+// Codec 负责类型 T 与缓存中字节切片之间的相互转换
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	// Unmarshal 解码 data。与 GetTyped 相同，TypedGroup 传入的是缓存内部的字节切片，
+	// Unmarshal 只能在调用期间读取它，不能修改或者持有，返回的 T 也不能引用 data 的底层数组
+	Unmarshal(data []byte) (T, error)
+}
+
+// TypedGroup 在 Group 的基础上使用 Codec 编解码，对外提供类型安全的访问。
+// 缓存中存储的仍然是编码后的字节，核心的 Group 保持不变。
+type TypedGroup[T any] struct {
+	group *Group
+	codec Codec[T]
+}
+
+// NewTypedGroup 使用已有的 Group 创建一个 TypedGroup
+func NewTypedGroup[T any](group *Group, codec Codec[T]) *TypedGroup[T] {
+	if group == nil {
+		panic("nil Group")
+	}
+	if codec == nil {
+		panic("nil Codec")
+	}
+	return &TypedGroup[T]{group: group, codec: codec}
+}
+
+// Group 返回底层的 Group
+func (tg *TypedGroup[T]) Group() *Group {
+	return tg.group
+}
+
+// Get 从底层 Group 获取值并解码
+func (tg *TypedGroup[T]) Get(key string) (T, error) {
+	view, err := tg.group.Get(key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return tg.codec.Unmarshal(view.b)
+}
+
+// Set 编码后写入底层 Group
+func (tg *TypedGroup[T]) Set(key string, value T) error {
+	bytes, err := tg.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	tg.group.Set(key, bytes)
+	return nil
+}
+
+// GetTyped 从 g 获取值并用 unmarshal 解码为 T，适合偶尔需要类型化访问、不想创建 TypedGroup 的场景。
+// 为了省去 ByteSlice 的拷贝，传给 unmarshal 的是缓存内部的字节切片，unmarshal 只能在调用期间读取它，
+// 不能修改或者持有。
+func GetTyped[T any](g *Group, key string, unmarshal func([]byte, *T) error) (T, error) {
+	var v T
+	view, err := g.Get(key)
+	if err != nil {
+		return v, err
+	}
+	err = unmarshal(view.b, &v)
+	return v, err
+}
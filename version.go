@@ -0,0 +1,31 @@
+package gee_cache
+
+import "time"
+
+// 多版本读取
+
+// GetVersion 只查询本地缓存，返回 key 在 notAfter 时刻的值，即写入时间不晚于 notAfter 的最新版本，不会调用 getter。
+// 需要通过 WithVersionHistory 保留旧版本并记录写入时间；没有开启时不知道写入时间，总是返回 false。
+// 没有足够早的版本时返回 false。
+func (g *Group) GetVersion(key string, notAfter time.Time) (ByteView, bool) {
+	key = g.normalizeKey(key)
+	if key == "" {
+		return ByteView{}, false
+	}
+	it, _, ok := g.mainCache.getItem(key)
+	if !ok {
+		return ByteView{}, false
+	}
+	if it.written.IsZero() { // 写入时间未知，无法判断是否不晚于 notAfter
+		return ByteView{}, false
+	}
+	if !it.written.After(notAfter) {
+		return it.value, true
+	}
+	for _, v := range it.history {
+		if !v.written.After(notAfter) {
+			return v.value, true
+		}
+	}
+	return ByteView{}, false
+}
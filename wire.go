@@ -0,0 +1,55 @@
+package gee_cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ByteView 的长度前缀编码，格式为 4 字节大端序的长度加上内容
+
+// MaxByteViewLen 是 ReadByteView 接受的最大长度，超过时返回 ErrByteViewTooLarge，不会分配内存。
+// WriteByteView 也拒绝写入超过它的值，保证写出的数据可以被读回。
+var MaxByteViewLen = 64 << 20
+
+// ErrByteViewTooLarge 表示长度前缀超过了 MaxByteViewLen
+var ErrByteViewTooLarge = errors.New("geecache: byte view too large")
+
+// WriteByteView 将 v 以长度前缀的格式写入 w
+func WriteByteView(w io.Writer, v ByteView) error {
+	if v.Len() > MaxByteViewLen {
+		return fmt.Errorf("%w: %d bytes", ErrByteViewTooLarge, v.Len())
+	}
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(v.Len()))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(v.b)
+	return err
+}
+
+// ReadByteView 从 r 读取一个 WriteByteView 写入的值。
+// r 在第一个字节之前就结束时返回 io.EOF，表示没有更多的值；读到一半结束时返回 io.ErrUnexpectedEOF。
+// 内存随着实际读到的数据增长，而不是按长度前缀一次性分配，因此截断的输入不会导致过量分配。
+func ReadByteView(r io.Reader) (ByteView, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return ByteView{}, err
+	}
+	n := binary.BigEndian.Uint32(header[:])
+	if uint64(n) > uint64(MaxByteViewLen) {
+		return ByteView{}, fmt.Errorf("%w: %d bytes", ErrByteViewTooLarge, n)
+	}
+	var buf bytes.Buffer
+	copied, err := io.CopyN(&buf, r, int64(n))
+	if copied < int64(n) {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return ByteView{}, err
+	}
+	return ByteView{b: cloneBytes(buf.Bytes())}, nil
+}
@@ -0,0 +1,84 @@
+package gee_cache
+
+import (
+	"errors"
+	"log"
+)
+
+// 回写（write-back）缓存
+
+// Writer 负责将脏条目写入后端存储
+type Writer interface {
+	Write(key string, value []byte) error
+}
+
+// WriterFunc 是一个函数类型，满足 Writer 接口
+type WriterFunc func(key string, value []byte) error
+
+// Write 实现 Writer 接口
+func (f WriterFunc) Write(key string, value []byte) error {
+	return f(key, value)
+}
+
+// SetDirty 写入一个值并标记为脏，脏条目会在 FlushDirty 或者离开缓存（淘汰、删除）之前写入后端存储。
+// 离开缓存时使用 WithWriteBack 配置的 Writer，未配置时脏数据会丢失。
+// 加载（包括后台刷新、ForceLoad 和 Prefetch）不会覆盖尚未回写的修改，之后用 Set 覆盖该 key 会丢弃它。
+func (g *Group) SetDirty(key string, value []byte) {
+	key = g.normalizeKey(key)
+	if key == "" {
+		return
+	}
+	g.mainCache.addItem(key, &item{value: ByteView{b: cloneBytes(value)}, dirty: true})
+}
+
+// FlushDirty 将所有脏条目写入 w，写入成功的条目清除脏标记。
+// 写入在锁外进行，写入期间被覆盖的条目保持原状。返回所有写入失败的错误。
+func (g *Group) FlushDirty(w Writer) error {
+	var errs []error
+	for _, e := range g.mainCache.dirtyEntries() {
+		if err := w.Write(e.key, e.item.value.b); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		g.mainCache.clean(e.key, e.item)
+	}
+	return errors.Join(errs...)
+}
+
+// writeBackFunc 返回离开缓存的脏条目使用的回写函数，失败时只能记录日志
+func writeBackFunc(w Writer) func(key string, value ByteView) {
+	return func(key string, value ByteView) {
+		if err := w.Write(key, value.b); err != nil {
+			log.Printf("[GeeCache] write back %s failed: %v", key, err)
+		}
+	}
+}
+
+// dirtyEntries 返回所有脏条目，它们的值会在锁外交给 Writer，因此标记为已经交出去
+func (c *cache) dirtyEntries() []evictedEntry {
+	c.lock()
+	defer c.unlock()
+
+	if c.lru == nil {
+		return nil
+	}
+	var entries []evictedEntry
+	for _, stored := range c.storedKeys() {
+		v, _ := c.lru.Peek(stored)
+		if it := v.(*item); it.dirty {
+			it.shared = true
+			entries = append(entries, evictedEntry{key: it.keyOf(stored), item: it, owner: c})
+		}
+	}
+	return entries
+}
+
+// clean 清除脏标记，如果 key 已经被覆盖为其它条目则不做处理
+func (c *cache) clean(key string, it *item) {
+	c.lock()
+	defer c.unlock()
+
+	if cur, ok := c.lookup(c.storeKey(key), key, false); ok && cur == it {
+		it.dirty = false
+	}
+}